@@ -0,0 +1,160 @@
+package lambda
+
+import (
+	"encoding/json"
+	"regexp"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// ApplyPatchType is the patch type of server-side apply
+	ApplyPatchType types.PatchType = "application/apply-patch+yaml"
+
+	causeTypeFieldManagerConflict metav1.CauseType = "FieldManagerConflict"
+)
+
+var (
+	conflictManagerRegexp = regexp.MustCompile(`conflict with "([^"]*)"`)
+
+	// serverPopulatedMetadata are the metadata fields populated by apiserver, which the field
+	// manager would take the ownership of if applied. A stale resourceVersion also conflicts.
+	serverPopulatedMetadata = []string{
+		"resourceVersion",
+		"uid",
+		"selfLink",
+		"generation",
+		"creationTimestamp",
+		"deletionTimestamp",
+		"deletionGracePeriodSeconds",
+		"managedFields",
+	}
+)
+
+// ApplyResult reports the outcome of server-side apply of an object
+type ApplyResult struct {
+	Namespace string
+	Name      string
+	Applied   bool
+	Conflicts []ApplyConflict
+}
+
+// ApplyConflict is a field owned by another field manager which
+// prevents the object from being applied without force
+type ApplyConflict struct {
+	Field   string
+	Manager string
+	Message string
+}
+
+// applyConflicts extracts the conflicted fields from the error of apply request
+func applyConflicts(err error) []ApplyConflict {
+	status, ok := err.(apierrors.APIStatus)
+	if !ok || !apierrors.IsConflict(err) || status.Status().Details == nil {
+		return nil
+	}
+	var conflicts []ApplyConflict
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != causeTypeFieldManagerConflict {
+			continue
+		}
+		conflict := ApplyConflict{
+			Field:   cause.Field,
+			Message: cause.Message,
+		}
+		if matches := conflictManagerRegexp.FindStringSubmatch(cause.Message); len(matches) == 2 {
+			conflict.Manager = matches[1]
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts
+}
+
+// restClientFor creates a REST client for the group version of the resource
+func restClientFor(config *rest.Config, gv schema.GroupVersion) (*rest.RESTClient, error) {
+	config = rest.CopyConfig(config)
+	config.GroupVersion = &gv
+	if gv.Group == "" {
+		config.APIPath = "/api"
+	} else {
+		config.APIPath = "/apis"
+	}
+	config.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: scheme.Codecs}
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	return rest.RESTClientFor(config)
+}
+
+// applyConfiguration serializes the object as the body of apply, leaving out the status and
+// the metadata populated by apiserver, e.g. the ones of an object read from the local cache
+func applyConfiguration(object runtime.Object) ([]byte, error) {
+	u, err := castObjectToUnstructured(object)
+	if err != nil {
+		return nil, err
+	}
+	unstructured.RemoveNestedField(u.Object, "status")
+	for _, field := range serverPopulatedMetadata {
+		unstructured.RemoveNestedField(u.Object, "metadata", field)
+	}
+	return json.Marshal(u)
+}
+
+// applyWithRESTClient sends a server-side apply patch of the object
+func applyWithRESTClient(client *rest.RESTClient, api *metav1.APIResource, object runtime.Object, fieldManager string, force bool) error {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return err
+	}
+	data, err := applyConfiguration(object)
+	if err != nil {
+		return err
+	}
+	req := client.Patch(ApplyPatchType).
+		NamespaceIfScoped(accessor.GetNamespace(), api.Namespaced).
+		Resource(api.Name).
+		Name(accessor.GetName()).
+		Param("fieldManager", fieldManager).
+		Body(data)
+	if force {
+		req = req.Param("force", "true")
+	}
+	return req.Do().Error()
+}
+
+// applyWithDynamicClient emulates server-side apply by creating the object if it
+// doesn't exist, or merge patching it otherwise. Field ownership is not tracked,
+// so it's only used for clients without rest config, e.g. Mock.
+func applyWithDynamicClient(client dynamic.ResourceInterface, object runtime.Object) error {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return err
+	}
+	u, err := castObjectToUnstructured(object)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Get(accessor.GetName(), metav1.GetOptions{}); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		_, err = client.Create(u)
+		return err
+	}
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	_, err = client.Patch(accessor.GetName(), types.MergePatchType, data)
+	return err
+}
@@ -0,0 +1,116 @@
+package lambda
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestApplyWithMock(t *testing.T) {
+	mock := Mock()
+	newConfigMap := func(value string) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{}
+		cm.Name = "testcm1"
+		cm.Namespace = "foons"
+		cm.Data = map[string]string{"key": value}
+		return cm
+	}
+	for _, value := range []string{"created", "applied"} {
+		value := value
+		results, err := mock.Type(ConfigMap).InNamespace("foons").
+			Add(func() *corev1.ConfigMap {
+				return newConfigMap(value)
+			}).
+			Apply("kcl", false)
+		assert.NoError(t, err, "some error")
+		assert.Equal(t, []ApplyResult{{Namespace: "foons", Name: "testcm1", Applied: true}}, results, "result wrong")
+	}
+	obj, err := mock.Type(ConfigMap).InNamespace("foons").List().Element()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, "applied", obj.(*corev1.ConfigMap).Data["key"], "not applied")
+}
+
+func TestApplyWithRESTClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "PATCH", req.Method, "method wrong")
+		assert.Equal(t, "/api/v1/namespaces/foons/configmaps/testcm1", req.URL.Path, "path wrong")
+		assert.Equal(t, string(ApplyPatchType), req.Header.Get("Content-Type"), "content type wrong")
+		assert.Equal(t, "kcl", req.URL.Query().Get("fieldManager"), "field manager wrong")
+		assert.Equal(t, "", req.URL.Query().Get("force"), "force wrong")
+		data, _ := ioutil.ReadAll(req.Body)
+		var body map[string]interface{}
+		assert.NoError(t, json.Unmarshal(data, &body), "body not json")
+		assert.Equal(t, map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name":      "testcm1",
+				"namespace": "foons",
+				"labels":    map[string]interface{}{"app": "foo"},
+			},
+			"data": map[string]interface{}{"key": "value"},
+		}, body, "server populated fields applied")
+
+		status := metav1.Status{
+			TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+			Status:   metav1.StatusFailure,
+			Reason:   metav1.StatusReasonConflict,
+			Code:     http.StatusConflict,
+			Details: &metav1.StatusDetails{
+				Causes: []metav1.StatusCause{
+					{Type: "FieldManagerConflict", Message: `conflict with "helm" using v1`, Field: ".data.key"},
+				},
+			},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(status)
+	}))
+	defer server.Close()
+
+	// as read from the local cache
+	cm := &corev1.ConfigMap{}
+	cm.Name = "testcm1"
+	cm.Namespace = "foons"
+	cm.Labels = map[string]string{"app": "foo"}
+	cm.Data = map[string]string{"key": "value"}
+	cm.ResourceVersion = "42"
+	cm.UID = "uid1"
+	cm.SelfLink = "/api/v1/namespaces/foons/configmaps/testcm1"
+	cm.Generation = 3
+	cm.CreationTimestamp = metav1.Now()
+	cm.Kind = ConfigMap.GetKind()
+	cm.APIVersion = ConfigMap.GetAPIVersion()
+	client, err := restClientFor(&rest.Config{Host: server.URL}, GetResouceIndexerInstance().GetGroupVersionKind(ConfigMap).GroupVersion())
+	assert.NoError(t, err, "some error")
+	err = applyWithRESTClient(client, GetResouceIndexerInstance().GetAPIResource(ConfigMap), cm, "kcl", false)
+	assert.Error(t, err, "conflict not reported")
+	assert.Equal(t, []ApplyConflict{
+		{Field: ".data.key", Manager: "helm", Message: `conflict with "helm" using v1`},
+	}, applyConflicts(err), "conflicts wrong")
+}
+
+func TestApplyConfiguration(t *testing.T) {
+	pod := &corev1.Pod{}
+	pod.Kind = Pod.GetKind()
+	pod.APIVersion = Pod.GetAPIVersion()
+	pod.Name = "testpod1"
+	pod.Namespace = "foons"
+	pod.ResourceVersion = "42"
+	pod.Spec.NodeName = "node1"
+	pod.Status.Phase = corev1.PodRunning
+	data, err := applyConfiguration(pod)
+	assert.NoError(t, err, "some error")
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &body), "body not json")
+	assert.NotContains(t, body, "status", "status applied")
+	assert.Equal(t, map[string]interface{}{"name": "testpod1", "namespace": "foons"}, body["metadata"], "metadata wrong")
+	assert.Equal(t, "node1", body["spec"].(map[string]interface{})["nodeName"], "spec not applied")
+}
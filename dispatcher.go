@@ -0,0 +1,82 @@
+package lambda
+
+import (
+	"sync"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// eventDispatcher is the only handler registered to an informer for the lambdas, fanning the
+// events out to the subscribers. Handlers can't be removed from informers and each of them
+// runs its own goroutines, so lambdas waiting for events subscribe here instead.
+type eventDispatcher struct {
+	lock     sync.RWMutex
+	nextID   int
+	handlers map[int]cache.ResourceEventHandler
+}
+
+// subscribe adds the handler until the returned function is called
+func (d *eventDispatcher) subscribe(handler cache.ResourceEventHandler) (unsubscribe func()) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	id := d.nextID
+	d.nextID++
+	d.handlers[id] = handler
+	return func() {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		delete(d.handlers, id)
+	}
+}
+
+func (d *eventDispatcher) subscribers() []cache.ResourceEventHandler {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	handlers := make([]cache.ResourceEventHandler, 0, len(d.handlers))
+	for _, handler := range d.handlers {
+		handlers = append(handlers, handler)
+	}
+	return handlers
+}
+
+func (d *eventDispatcher) OnAdd(obj interface{}) {
+	for _, handler := range d.subscribers() {
+		handler.OnAdd(obj)
+	}
+}
+
+func (d *eventDispatcher) OnUpdate(oldObj, newObj interface{}) {
+	for _, handler := range d.subscribers() {
+		handler.OnUpdate(oldObj, newObj)
+	}
+}
+
+func (d *eventDispatcher) OnDelete(obj interface{}) {
+	for _, handler := range d.subscribers() {
+		handler.OnDelete(obj)
+	}
+}
+
+// eventDispatchers holds the dispatcher of every informer of a client
+type eventDispatchers struct {
+	lock        sync.Mutex
+	dispatchers map[cache.SharedIndexInformer]*eventDispatcher
+}
+
+// dispatcherFor returns the dispatcher of the informer, registering it upon the first call
+func (ds *eventDispatchers) dispatcherFor(informer cache.SharedIndexInformer) *eventDispatcher {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	if d, ok := ds.dispatchers[informer]; ok {
+		return d
+	}
+	if ds.dispatchers == nil {
+		ds.dispatchers = make(map[cache.SharedIndexInformer]*eventDispatcher)
+	}
+	d := &eventDispatcher{
+		handlers: make(map[int]cache.ResourceEventHandler),
+	}
+	informer.AddEventHandler(d)
+	ds.dispatchers[informer] = d
+	return d
+}
@@ -0,0 +1,273 @@
+package lambda
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+)
+
+// DryRunOption configures dry-run lambda
+type DryRunOption func(*dryRunConfig)
+
+type dryRunConfig struct {
+	server bool
+}
+
+// WithServerDryRun forwards every recorded mutation to the apiserver with dryRun=All,
+// so that admission and validation errors are reported as well. It takes no effect on
+// clients without rest config, e.g. Mock.
+func WithServerDryRun() DryRunOption {
+	return func(config *dryRunConfig) {
+		config.server = true
+	}
+}
+
+// PlannedAction is a mutation which a dry-run lambda would make
+type PlannedAction struct {
+	Verb      string
+	Resource  Resource
+	Namespace string
+	Name      string
+	// Diff is the JSON of created or applied object, the patch sent, or the merge
+	// patch from the cached object to the updated one. For scaling, it's the merge
+	// patch of the scale subresource. For deletion, it's the JSON
+	// of delete options or empty if no option is specified.
+	Diff string
+	// Err is the error returned by the apiserver if server dry-run is enabled
+	Err error
+}
+
+func (action PlannedAction) String() string {
+	target := action.Name
+	if action.Namespace != "" {
+		target = action.Namespace + "/" + action.Name
+	}
+	msg := fmt.Sprintf("%s %s %s", action.Verb, action.Resource.Name, target)
+	if action.Diff != "" {
+		msg += " " + action.Diff
+	}
+	if action.Err != nil {
+		msg += fmt.Sprintf(" (error: %v)", action.Err)
+	}
+	return msg
+}
+
+// Plan records the mutations a dry-run lambda would make instead of executing them
+type Plan struct {
+	lock    sync.Mutex
+	actions []PlannedAction
+}
+
+func (plan *Plan) add(action PlannedAction) {
+	plan.lock.Lock()
+	defer plan.lock.Unlock()
+	plan.actions = append(plan.actions, action)
+}
+
+// Actions returns the mutations recorded so far
+func (plan *Plan) Actions() []PlannedAction {
+	plan.lock.Lock()
+	defer plan.lock.Unlock()
+	return append([]PlannedAction(nil), plan.actions...)
+}
+
+func (plan *Plan) String() string {
+	msgs := []string{}
+	for _, action := range plan.Actions() {
+		msgs = append(msgs, action.String())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// DryRun makes every kubernetes operation downstream record what it would do into
+// the plan instead of calling the apiserver. Reads from the local cache still happen
+// so that CreateIfNotExist, UpdateOrCreate and friends plan as they would execute.
+func (lambda *Lambda) DryRun(opts ...DryRunOption) *Lambda {
+	config := &dryRunConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	l := lambda.Dummy()
+	l.plan = &Plan{}
+	gvk := GetResouceIndexerInstance().GetGroupVersionKind(l.rs)
+	record := func(verb string, object runtime.Object, diff string, patchType types.PatchType, data []byte, params map[string]string) error {
+		action := PlannedAction{
+			Verb:     verb,
+			Resource: l.rs,
+			Diff:     diff,
+		}
+		if accessor, err := meta.Accessor(object); err == nil {
+			action.Namespace = accessor.GetNamespace()
+			action.Name = accessor.GetName()
+		}
+		if config.server && l.serverDryRunFunc != nil {
+			action.Err = l.serverDryRunFunc(verb, object, patchType, data, params)
+		}
+		l.plan.add(action)
+		return action.Err
+	}
+	l.createFunc = func(object runtime.Object) error {
+		object.GetObjectKind().SetGroupVersionKind(gvk)
+		data, err := json.Marshal(object)
+		if err != nil {
+			return err
+		}
+		return record(VerbCreate, object, string(data), "", data, nil)
+	}
+	recordUpdate := func(verb string) func(runtime.Object) error {
+		return func(object runtime.Object) error {
+			object.GetObjectKind().SetGroupVersionKind(gvk)
+			data, err := json.Marshal(object)
+			if err != nil {
+				return err
+			}
+			diff := ""
+			if accessor, err := meta.Accessor(object); err == nil {
+				if current, err := l.getFunc(accessor.GetNamespace(), accessor.GetName()); err == nil {
+					current = current.DeepCopyObject()
+					current.GetObjectKind().SetGroupVersionKind(gvk)
+					if _, patch, err := createPatch(current, object); err == nil {
+						diff = string(patch)
+					}
+				}
+			}
+			return record(verb, object, diff, "", data, nil)
+		}
+	}
+	l.updateFunc = recordUpdate(VerbUpdate)
+	l.deleteFunc = func(object runtime.Object, opts *metav1.DeleteOptions) error {
+		diff := ""
+		if opts != nil && !reflect.DeepEqual(*opts, metav1.DeleteOptions{}) {
+			data, err := json.Marshal(opts)
+			if err != nil {
+				return err
+			}
+			diff = string(data)
+		}
+		body, err := dryRunDeleteBody(opts)
+		if err != nil {
+			return err
+		}
+		return record(VerbDelete, object, diff, "", body, nil)
+	}
+	l.patchFunc = func(object runtime.Object, patchType types.PatchType, data []byte) error {
+		return record(VerbPatch, object, string(data), patchType, data, nil)
+	}
+	l.applyFunc = func(object runtime.Object, fieldManager string, force bool) error {
+		object.GetObjectKind().SetGroupVersionKind(gvk)
+		data, err := json.Marshal(object)
+		if err != nil {
+			return err
+		}
+		params := map[string]string{"fieldManager": fieldManager}
+		if force {
+			params["force"] = "true"
+		}
+		return record(VerbApply, object, string(data), ApplyPatchType, data, params)
+	}
+	l.updateStatusFunc = recordUpdate(VerbUpdateStatus)
+	l.patchStatusFunc = func(object runtime.Object, patchType types.PatchType, data []byte) error {
+		return record(VerbPatchStatus, object, string(data), patchType, data, nil)
+	}
+	l.evictFunc = func(object runtime.Object, opts *metav1.DeleteOptions) error {
+		accessor, err := meta.Accessor(object)
+		if err != nil {
+			return err
+		}
+		eviction, err := newEviction(accessor.GetNamespace(), accessor.GetName(), opts)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(eviction)
+		if err != nil {
+			return err
+		}
+		return record(VerbEvict, object, string(data), "", data, nil)
+	}
+	l.scaleFunc = func(object runtime.Object, replicas func(int32) int32) error {
+		current, err := l.toUnstructured(object)
+		if err != nil {
+			return err
+		}
+		data := []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas(getReplicas(current))))
+		return record(VerbScale, object, string(data), types.MergePatchType, data, nil)
+	}
+	return l
+}
+
+// Plan returns the mutations recorded by the dry-run lambda, or nil if
+// the lambda is not in dry-run mode
+func (lambda *Lambda) Plan() *Plan {
+	return lambda.plan
+}
+
+// dryRunDeleteBody serializes the delete options with dryRun set as the body of the delete
+// request, so that apiserver checks the options and the preconditions. The vendored
+// DeleteOptions has no dryRun field so it's added to the serialized options.
+func dryRunDeleteBody(opts *metav1.DeleteOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &metav1.DeleteOptions{}
+	}
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+	body["kind"] = "DeleteOptions"
+	body["apiVersion"] = "v1"
+	body["dryRun"] = []string{"All"}
+	return json.Marshal(body)
+}
+
+// dryRunWithRESTClient sends the mutation with dryRun=All so that nothing is persisted
+func dryRunWithRESTClient(client *rest.RESTClient, api *metav1.APIResource, verb string, object runtime.Object, patchType types.PatchType, data []byte, params map[string]string) error {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return err
+	}
+	var req *rest.Request
+	switch verb {
+	case VerbCreate, VerbEvict:
+		req = client.Post()
+	case VerbUpdate, VerbUpdateStatus:
+		req = client.Put()
+	case VerbDelete:
+		req = client.Delete()
+	case VerbPatch, VerbApply, VerbScale, VerbPatchStatus:
+		req = client.Patch(patchType)
+	default:
+		return fmt.Errorf("unsupported dry-run verb %s", verb)
+	}
+	req = req.NamespaceIfScoped(accessor.GetNamespace(), api.Namespaced).
+		Resource(api.Name).
+		Param("dryRun", "All")
+	switch verb {
+	case VerbScale:
+		req = req.SubResource(SubresourceScale)
+	case VerbUpdateStatus, VerbPatchStatus:
+		req = req.SubResource(SubresourceStatus)
+	case VerbEvict:
+		req = req.SubResource(SubresourceEviction)
+	}
+	if verb != VerbCreate {
+		req = req.Name(accessor.GetName())
+	}
+	if data != nil {
+		req = req.Body(data)
+	}
+	for key, value := range params {
+		req = req.Param(key, value)
+	}
+	return req.Do().Error()
+}
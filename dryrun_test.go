@@ -0,0 +1,99 @@
+package lambda
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+)
+
+func TestDryRun(t *testing.T) {
+	cm := &corev1.ConfigMap{}
+	cm.Name = "testcm1"
+	cm.Namespace = "foons"
+	cm.Data = map[string]string{"key": "value"}
+	mock := Mock(cm)
+
+	lambda := mock.Type(ConfigMap).InNamespace("foons").List().
+		Map(func(cm *corev1.ConfigMap) *corev1.ConfigMap {
+			cm = cm.DeepCopy()
+			cm.Data["key"] = "changed"
+			return cm
+		}).
+		Add(func() *corev1.ConfigMap {
+			cm := &corev1.ConfigMap{}
+			cm.Name = "testcm2"
+			cm.Namespace = "foons"
+			return cm
+		}).
+		DryRun()
+	updated, created, err := lambda.UpdateOrCreate()
+	assert.NoError(t, err, "some error")
+	assert.True(t, updated, "not updated")
+	assert.True(t, created, "not created")
+
+	actions := lambda.Plan().Actions()
+	assert.Equal(t, 2, len(actions), "plan wrong")
+	assert.Equal(t, VerbUpdate, actions[0].Verb, "verb wrong")
+	assert.Equal(t, "testcm1", actions[0].Name, "name wrong")
+	assert.Equal(t, `{"data":{"key":"changed"}}`, actions[0].Diff, "diff wrong")
+	assert.Equal(t, VerbCreate, actions[1].Verb, "verb wrong")
+	assert.Equal(t, "testcm2", actions[1].Name, "name wrong")
+
+	lambda = mock.Type(ConfigMap).InNamespace("foons").List().DryRun()
+	deleted, err := lambda.Delete()
+	assert.NoError(t, err, "some error")
+	assert.True(t, deleted, "not deleted")
+	assert.Equal(t, "delete ConfigMaps foons/testcm1", lambda.Plan().String(), "plan wrong")
+
+	count, err := mock.Type(ConfigMap).InNamespace("foons").List().Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 1, count, "dry run persisted")
+}
+
+func TestServerDryRunDelete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "DELETE", req.Method, "method wrong")
+		assert.Equal(t, "/api/v1/namespaces/foons/configmaps/testcm1", req.URL.Path, "path wrong")
+		assert.Equal(t, "All", req.URL.Query().Get("dryRun"), "dry run not requested")
+		body := make(map[string]interface{})
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&body), "body not sent")
+		assert.Equal(t, map[string]interface{}{
+			"kind":              "DeleteOptions",
+			"apiVersion":        "v1",
+			"dryRun":            []interface{}{"All"},
+			"propagationPolicy": "Foreground",
+			"preconditions":     map[string]interface{}{"uid": "uid1"},
+		}, body, "body wrong")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(metav1.Status{
+			TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+			Status:   metav1.StatusSuccess,
+		})
+	}))
+	defer server.Close()
+
+	cm := &corev1.ConfigMap{}
+	cm.Name = "testcm1"
+	cm.Namespace = "foons"
+	cm.UID = "uid1"
+	client, err := restClientFor(&rest.Config{Host: server.URL}, GetResouceIndexerInstance().GetGroupVersionKind(ConfigMap).GroupVersion())
+	assert.NoError(t, err, "some error")
+	lambda := Mock(cm).Type(ConfigMap).InNamespace("foons").List()
+	lambda.serverDryRunFunc = func(verb string, object runtime.Object, patchType types.PatchType, data []byte, params map[string]string) error {
+		return dryRunWithRESTClient(client, GetResouceIndexerInstance().GetAPIResource(ConfigMap), verb, object, patchType, data, params)
+	}
+	lambda = lambda.DryRun(WithServerDryRun())
+	deleted, err := lambda.DeleteForeground()
+	assert.NoError(t, err, "some error")
+	assert.True(t, deleted, "not deleted")
+	assert.Equal(t, 1, len(lambda.Plan().Actions()), "plan wrong")
+}
@@ -277,11 +277,12 @@ func TestWatchResource(t *testing.T) {
 	countLock := &sync.Mutex{}
 
 	addCount := 0
-	mockKCL.Type(kcl.ConfigMap).OnAdd(func(obj interface{}) {
+	err := mockKCL.Type(kcl.ConfigMap).OnAdd(func(obj interface{}) {
 		countLock.Lock()
 		addCount++
 		countLock.Unlock()
 	})
+	assert.NoError(t, err, "some error")
 	testFunc := func(kclInterface kcl.KubernetesClientLambda) {
 		testConfigMapName := "test-abc"
 		created, err := kclInterface.Type(kcl.ConfigMap).
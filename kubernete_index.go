@@ -5,10 +5,12 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/kubernetes/scheme"
 )
@@ -25,6 +27,19 @@ type ResourceIndexer interface {
 	GetGroupVersionResource(resource Resource) schema.GroupVersionResource
 }
 
+// SubresourceIndexer tells if the resource serves the subresource. It's optional to the
+// clients so that the implementers of ResourceIndexer and KubernetesClientLambda are kept.
+type SubresourceIndexer interface {
+	HasSubresource(resource Resource, subresource string) (bool, error)
+}
+
+// Subresources checked before the operations through them
+const (
+	SubresourceStatus   = "status"
+	SubresourceScale    = "scale"
+	SubresourceEviction = "eviction"
+)
+
 type resourceIndexerImpl struct {
 	store map[Resource]*metav1.APIResource
 }
@@ -137,6 +152,13 @@ func (indexer *resourceIndexerImpl) GetGroupVersionResource(resource Resource) s
 	}
 }
 
+// subresourceAPIResource returns the api resource of the subresource of the resource
+func subresourceAPIResource(resource Resource, subresource string) *metav1.APIResource {
+	api := *GetResouceIndexerInstance().GetAPIResource(resource)
+	api.Name += "/" + subresource
+	return &api
+}
+
 func (indexer *resourceIndexerImpl) GetAPIResource(resource Resource) *metav1.APIResource {
 	return indexer.store[resource]
 }
@@ -149,3 +171,45 @@ func (indexer *resourceIndexerImpl) GetGroupVersionKind(resource Resource) schem
 		Kind:    apiResource.Kind,
 	}
 }
+
+// discoveryIndexer finds the subresources in the "resource/subresource" entries served by the
+// discovery of apiserver. The api resources of every group version are read once.
+type discoveryIndexer struct {
+	client    discovery.DiscoveryInterface
+	lock      sync.Mutex
+	resources map[string]*metav1.APIResourceList
+}
+
+var _ SubresourceIndexer = &discoveryIndexer{}
+
+func newDiscoveryIndexer(client discovery.DiscoveryInterface) *discoveryIndexer {
+	return &discoveryIndexer{
+		client:    client,
+		resources: make(map[string]*metav1.APIResourceList),
+	}
+}
+
+func (indexer *discoveryIndexer) HasSubresource(resource Resource, subresource string) (bool, error) {
+	apiResource := GetResouceIndexerInstance().GetAPIResource(resource)
+	if apiResource == nil {
+		return false, fmt.Errorf("unindexed resource %s", resource)
+	}
+	groupVersion := schema.GroupVersion{Group: apiResource.Group, Version: apiResource.Version}.String()
+	indexer.lock.Lock()
+	defer indexer.lock.Unlock()
+	list, ok := indexer.resources[groupVersion]
+	if !ok {
+		var err error
+		list, err = indexer.client.ServerResourcesForGroupVersion(groupVersion)
+		if err != nil {
+			return false, err
+		}
+		indexer.resources[groupVersion] = list
+	}
+	for _, served := range list.APIResources {
+		if served.Name == apiResource.Name+"/"+subresource {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
 )
 
 func TestFirstLetterCaptalization(t *testing.T) {
@@ -16,3 +18,29 @@ func TestFirstLetterCaptalization(t *testing.T) {
 func TestIndexerInitialization(t *testing.T) {
 	initIndexer()
 }
+
+func TestDiscoverySubresources(t *testing.T) {
+	_, fakeClient := NewFakes()
+	indexer := newDiscoveryIndexer(fakeClient.Discovery())
+	hasSubresource := func(resource Resource, subresource string) bool {
+		served, err := indexer.HasSubresource(resource, subresource)
+		assert.NoError(t, err, "some error")
+		return served
+	}
+	assert.True(t, hasSubresource(Pod, SubresourceStatus), "pod has status")
+	assert.True(t, hasSubresource(Deployment, SubresourceStatus), "deployment has status")
+	assert.True(t, hasSubresource(Deployment, SubresourceScale), "deployment has scale")
+	assert.False(t, hasSubresource(ConfigMap, SubresourceStatus), "configmap has no status")
+	assert.False(t, hasSubresource(Pod, SubresourceScale), "pod has no scale")
+
+	// served subresources are read from discovery rather than guessed from the types
+	fakeClient.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{{Name: "pods"}, {Name: "configmaps"}, {Name: "configmaps/status"}},
+	}}
+	indexer = newDiscoveryIndexer(fakeClient.Discovery())
+	assert.True(t, hasSubresource(ConfigMap, SubresourceStatus), "served status not discovered")
+	assert.False(t, hasSubresource(Pod, SubresourceStatus), "status not served discovered")
+	_, err := indexer.HasSubresource(Deployment, SubresourceStatus)
+	assert.Error(t, err, "missing group version discovered")
+}
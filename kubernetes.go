@@ -1,14 +1,20 @@
 package lambda
 
 import (
-	"os"
+	"context"
+	"fmt"
+	"io/ioutil"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
@@ -21,6 +27,10 @@ var (
 	versionParseRegexp = regexp.MustCompile(`v(\d+)((alpha|beta)(\d+))?`)
 )
 
+const (
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
 type Version string
 
 func (v Version) GetNumericVersion() string {
@@ -49,91 +59,353 @@ type Resource struct {
 type kubernetesExecutable struct {
 	Rs              Resource
 	namespaces      []string
+	kcl             KubernetesClientLambda
 	clientInterface dynamic.Interface
-	informer        informers.GenericInformer
+
+	// informerFactories are keyed by the namespace watched, or NamespaceAll
+	informerFactories map[string]informers.SharedInformerFactory
+	cacheSyncTimeout  time.Duration
+	pageSize          int64
+	informerLock      sync.Mutex
+	// startedInformers are keyed by the namespace of their factories
+	startedInformers map[string]informers.GenericInformer
+	dispatchers      *eventDispatchers
 }
 
 // KubernetesClientLambda provides manipulation interface for resources
 type KubernetesClientLambda interface {
+	// Type panics if the resource is not supported, see TypeE
 	Type(Resource) *kubernetesExecutable
+	// TypeE creates an executable for the resource. The informer of the resource isn't started
+	// until the local cache is read for the first time.
+	TypeE(Resource) (*kubernetesExecutable, error)
 	GetRestConfig() *rest.Config
+	// GetDefaultNamespace returns the namespace of the kubeconfig context,
+	// or "default" if it's not specified
+	GetDefaultNamespace() string
 }
 
 type kubernetesClientLambdaImpl struct {
-	informerFactory informers.SharedInformerFactory
-	clientPool      dynamic.ClientPool
-	restConfig      *rest.Config
+	informerFactories map[string]informers.SharedInformerFactory
+	clientPool        dynamic.ClientPool
+	restConfig        *rest.Config
+	defaultNamespace  string
+	cacheSyncTimeout  time.Duration
+	pageSize          int64
+	dispatchers       eventDispatchers
+	subresources      SubresourceIndexer
 }
 
+var _ SubresourceIndexer = &kubernetesClientLambdaImpl{}
+
 func (kcl *kubernetesClientLambdaImpl) GetRestConfig() *rest.Config {
 	return kcl.restConfig
 }
 
+func (kcl *kubernetesClientLambdaImpl) GetDefaultNamespace() string {
+	if kcl.defaultNamespace == "" {
+		return metav1.NamespaceDefault
+	}
+	return kcl.defaultNamespace
+}
+
+// HasSubresource tells if the resource serves the subresource according to the discovery of apiserver
+func (kcl *kubernetesClientLambdaImpl) HasSubresource(rs Resource, subresource string) (bool, error) {
+	return kcl.subresources.HasSubresource(rs, subresource)
+}
+
 func (kcl *kubernetesClientLambdaImpl) Type(rs Resource) *kubernetesExecutable {
+	exec, err := kcl.TypeE(rs)
+	if err != nil {
+		panic(err)
+	}
+	return exec
+}
+
+func (kcl *kubernetesClientLambdaImpl) TypeE(rs Resource) (*kubernetesExecutable, error) {
+	if GetResouceIndexerInstance().GetAPIResource(rs) == nil {
+		return nil, fmt.Errorf("unindexed resource %s", rs)
+	}
 	gvr := GetResouceIndexerInstance().GetGroupVersionResource(rs)
 	i, err := kcl.clientPool.ClientForGroupVersionResource(gvr)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	return &kubernetesExecutable{
+		Rs:                rs,
+		kcl:               kcl,
+		clientInterface:   i,
+		informerFactories: kcl.informerFactories,
+		cacheSyncTimeout:  kcl.cacheSyncTimeout,
+		pageSize:          kcl.pageSize,
+		startedInformers:  make(map[string]informers.GenericInformer),
+		dispatchers:       &kcl.dispatchers,
+	}, nil
+}
+
+// watchedNamespaces returns the namespaces which the informers are restricted to, or nil
+// if every namespace is watched
+func (exec *kubernetesExecutable) watchedNamespaces() []string {
+	if _, ok := exec.informerFactories[metav1.NamespaceAll]; ok {
+		return nil
+	}
+	namespaces := make([]string, 0, len(exec.informerFactories))
+	for namespace := range exec.informerFactories {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// defaultNamespaces returns the namespaces read by the lambda if none is specified
+func (exec *kubernetesExecutable) defaultNamespaces() []string {
+	if watched := exec.watchedNamespaces(); watched != nil && GetResouceIndexerInstance().IsNamespaced(exec.Rs) {
+		return watched
+	}
+	return []string{metav1.NamespaceAll}
+}
+
+// informerNamespace returns the namespace of the informer factory serving the namespace
+func (exec *kubernetesExecutable) informerNamespace(namespace string) (string, error) {
+	if len(exec.informerFactories) == 0 {
+		return "", fmt.Errorf("no informer for %s", exec.Rs.Name)
+	}
+	watched := exec.watchedNamespaces()
+	if watched == nil {
+		return metav1.NamespaceAll, nil
+	}
+	if !GetResouceIndexerInstance().IsNamespaced(exec.Rs) {
+		// informers of cluster-scoped resources ignore the namespace of the factory
+		return watched[0], nil
 	}
+	if _, ok := exec.informerFactories[namespace]; ok {
+		return namespace, nil
+	}
+	return "", fmt.Errorf("namespace %q of %s isn't watched by the informers", namespace, exec.Rs.Name)
+}
 
-	exec := &kubernetesExecutable{
-		Rs:              rs,
-		clientInterface: i,
+// getInformer returns the informer of the resource serving the namespace, starting it and
+// waiting for the local cache synced upon the first call
+func (exec *kubernetesExecutable) getInformer(namespace string) (informers.GenericInformer, error) {
+	key, err := exec.informerNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	exec.informerLock.Lock()
+	defer exec.informerLock.Unlock()
+	if informer, ok := exec.startedInformers[key]; ok {
+		return informer, nil
+	}
+	factory := exec.informerFactories[key]
+	gvr := GetResouceIndexerInstance().GetGroupVersionResource(exec.Rs)
+	informer, err := factory.ForResource(gvr)
+	if err != nil {
+		return nil, err
 	}
-	if kcl.informerFactory != nil {
-		informer, err := kcl.informerFactory.ForResource(gvr)
+	if !informer.Informer().HasSynced() {
+		factory.Start(make(chan struct{}))
+		stop := make(chan struct{})
+		if exec.cacheSyncTimeout > 0 {
+			timer := time.AfterFunc(exec.cacheSyncTimeout, func() {
+				close(stop)
+			})
+			defer timer.Stop()
+		}
+		if !cache.WaitForCacheSync(stop, informer.Informer().HasSynced) {
+			return nil, fmt.Errorf("timed out after %v waiting for cache of %s synced", exec.cacheSyncTimeout, exec.Rs.Name)
+		}
+	}
+	exec.startedInformers[key] = informer
+	return informer, nil
+}
+
+// getInformers returns the distinct informers serving the namespaces
+func (exec *kubernetesExecutable) getInformers(namespaces []string) ([]informers.GenericInformer, error) {
+	var result []informers.GenericInformer
+	seen := make(map[informers.GenericInformer]bool)
+	for _, namespace := range namespaces {
+		informer, err := exec.getInformer(namespace)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		if informer.Informer().LastSyncResourceVersion() == "" {
-			kcl.informerFactory.Start(make(chan struct{}))
-			// TODO: set timeout for waiting cache sync
-			cache.WaitForCacheSync(make(chan struct{}), informer.Informer().HasSynced)
+		if !seen[informer] {
+			seen[informer] = true
+			result = append(result, informer)
 		}
-		exec.informer = informer
 	}
-	return exec
+	return result, nil
 }
 
-func getKCLFromConfig(config *rest.Config) *kubernetesClientLambdaImpl {
-	clientset, err := kubernetes.NewForConfig(config)
+// waitForCacheSync waits for the local cache synced after writing, unless the informer
+// isn't started because nothing is read from the local cache yet
+func (exec *kubernetesExecutable) waitForCacheSync() {
+	exec.informerLock.Lock()
+	started := make([]informers.GenericInformer, 0, len(exec.startedInformers))
+	for _, informer := range exec.startedInformers {
+		started = append(started, informer)
+	}
+	exec.informerLock.Unlock()
+	for _, informer := range started {
+		cache.WaitForCacheSync(make(chan struct{}), informer.Informer().HasSynced)
+	}
+}
+
+// NewForConfig creates a client lambda from the rest config
+func NewForConfig(config *rest.Config, opts ...Option) (KubernetesClientLambda, error) {
+	return getKCLFromConfig(config, newClientOptions(opts))
+}
+
+// MustNewForConfig creates a client lambda from the rest config and panics on failure
+func MustNewForConfig(config *rest.Config, opts ...Option) KubernetesClientLambda {
+	kcl, err := NewForConfig(config, opts...)
 	if err != nil {
 		panic(err)
 	}
+	return kcl
+}
 
-	factory := informers.NewSharedInformerFactory(clientset, time.Minute)
-	return &kubernetesClientLambdaImpl{
-		informerFactory: factory,
-		clientPool:      dynamic.NewDynamicClientPool(config),
-		restConfig:      config,
+// InCluster creates a client lambda from the service account mounted in the pod
+func InCluster(opts ...Option) (KubernetesClientLambda, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	kcl, err := getKCLFromConfig(config, newClientOptions(opts))
+	if err != nil {
+		return nil, err
 	}
+	// the namespace of the service account
+	if data, err := ioutil.ReadFile(serviceAccountNamespaceFile); err == nil {
+		kcl.defaultNamespace = strings.TrimSpace(string(data))
+	}
+	return kcl, nil
 }
 
-// OutOfClusterDefault loads configuration from ~/.kube/config
-func OutOfClusterDefault() KubernetesClientLambda {
-	return OutOfClusterInContext("")
+// MustInCluster creates a client lambda in the pod and panics on failure, see InCluster
+func MustInCluster(opts ...Option) KubernetesClientLambda {
+	kcl, err := InCluster(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return kcl
 }
 
-// OutOfClusterInContext is used to switch context of multi-cluster kubernetes
-func OutOfClusterInContext(context string) KubernetesClientLambda {
-	config, err := clientcmd.LoadFromFile(os.Getenv("HOME") + "/.kube/config")
+func getKCLFromConfig(config *rest.Config, options *clientOptions) (*kubernetesClientLambdaImpl, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	config = options.applyToConfig(config)
+	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	return &kubernetesClientLambdaImpl{
+		informerFactories: options.newInformerFactories(clientset),
+		clientPool:        dynamic.NewDynamicClientPool(config),
+		restConfig:        config,
+		cacheSyncTimeout:  options.cacheSyncTimeout,
+		pageSize:          options.pageSize,
+		subresources:      newDiscoveryIndexer(clientset.Discovery()),
+	}, nil
+}
+
+// LoadOptions configures loading kubeconfig files for OutOfCluster
+type LoadOptions struct {
+	// Paths are the kubeconfig files merged in order, the former taking precedence.
+	// The files in KUBECONFIG environment variable, or ~/.kube/config if it's not set,
+	// are loaded by default.
+	Paths []string
+	// Context overrides the current context of the kubeconfig
+	Context string
+	// Overrides are passed through to clientcmd, e.g. to override the server
+	// or the namespace of the context
+	Overrides *clientcmd.ConfigOverrides
+}
+
+// OutOfCluster loads configuration from kubeconfig files with the loading rules of
+// kubectl. The namespace of the context is used by InDefaultNamespace.
+func OutOfCluster(loadOpts LoadOptions, opts ...Option) (KubernetesClientLambda, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if len(loadOpts.Paths) > 0 {
+		rules.Precedence = loadOpts.Paths
+	}
+	overrides := &clientcmd.ConfigOverrides{}
+	if loadOpts.Overrides != nil {
+		copied := *loadOpts.Overrides
+		overrides = &copied
 	}
-	if config == nil || config.Contexts == nil {
-		panic("something's wrong with kube config file")
+	if loadOpts.Context != "" {
+		overrides.CurrentContext = loadOpts.Context
 	}
-	if context != "" {
-		config.CurrentContext = context
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, err
 	}
-	clientConfig, err := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
+	kcl, err := getKCLFromConfig(config, newClientOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	kcl.defaultNamespace = namespace
+	return kcl, nil
+}
+
+// MustOutOfCluster loads configuration from kubeconfig files and panics on failure, see OutOfCluster
+func MustOutOfCluster(loadOpts LoadOptions, opts ...Option) KubernetesClientLambda {
+	kcl, err := OutOfCluster(loadOpts, opts...)
 	if err != nil {
 		panic(err)
 	}
-	return getKCLFromConfig(clientConfig)
+	return kcl
+}
+
+// OutOfClusterDefault loads configuration from KUBECONFIG or ~/.kube/config
+func OutOfClusterDefault() KubernetesClientLambda {
+	return OutOfClusterInContext("")
+}
+
+// OutOfClusterDefaultWithOptions is OutOfClusterDefault configured by the options
+func OutOfClusterDefaultWithOptions(opts ...Option) KubernetesClientLambda {
+	return OutOfClusterInContextWithOptions("", opts...)
+}
+
+// OutOfClusterInContext is used to switch context of multi-cluster kubernetes.
+// It panics if the kubeconfig fails loading, see OutOfCluster.
+func OutOfClusterInContext(context string) KubernetesClientLambda {
+	return OutOfClusterInContextWithOptions(context)
+}
+
+// OutOfClusterInContextWithOptions is OutOfClusterInContext configured by the options
+func OutOfClusterInContextWithOptions(context string, opts ...Option) KubernetesClientLambda {
+	return MustOutOfCluster(LoadOptions{Context: context}, opts...)
 }
 
+// InNamespace creates a lambda for the resource in the namespaces.
+// Listing in every namespace if no namespace is given, or in every namespace
+// watched if the informers are restricted by WithNamespace.
 func (exec *kubernetesExecutable) InNamespace(namespaces ...string) *Lambda {
+	return exec.InNamespaceContext(context.Background(), namespaces...)
+}
+
+// InNamespaceLive creates a lambda reading from apiserver instead of the local cache, see
+// Lambda.Live. The informer of the resource is never started for reading.
+func (exec *kubernetesExecutable) InNamespaceLive(namespaces ...string) *Lambda {
+	return exec.InNamespace(namespaces...).Live()
+}
+
+// InDefaultNamespace creates a lambda for the resource in the namespace of the kubeconfig context
+func (exec *kubernetesExecutable) InDefaultNamespace() *Lambda {
+	return exec.InNamespace(exec.kcl.GetDefaultNamespace())
+}
+
+// InNamespaceContext creates a lambda bound to the context, see Lambda.WithContext
+func (exec *kubernetesExecutable) InNamespaceContext(ctx context.Context, namespaces ...string) *Lambda {
 	rs := exec.Rs
 	gvk := GetResouceIndexerInstance().GetGroupVersionKind(rs)
 
@@ -141,19 +413,77 @@ func (exec *kubernetesExecutable) InNamespace(namespaces ...string) *Lambda {
 
 	ch := make(chan runtime.Object)
 
-	if len(namespaces) == 0 {
-		exec.namespaces = []string{metav1.NamespaceAll}
+	var restClient *rest.RESTClient
+	var restClientErr error
+	if config := exec.kcl.GetRestConfig(); config != nil {
+		restClient, restClientErr = restClientFor(config, gvk.GroupVersion())
 	}
 
+	if len(namespaces) == 0 || len(namespaces) == 1 && namespaces[0] == metav1.NamespaceAll {
+		exec.namespaces = exec.defaultNamespaces()
+	}
+	lambdaNamespaces := exec.namespaces
+
 	l := &Lambda{
 		rs:         exec.Rs,
 		namespaces: exec.namespaces,
+		kcl:        exec.kcl,
+		ctx:        ctx,
+		errs:       &errorChain{},
 		val:        ch,
 		getFunc: func(namespace, name string) (runtime.Object, error) {
-			return exec.informer.Lister().ByNamespace(namespace).Get(name)
+			informer, err := exec.getInformer(namespace)
+			if err != nil {
+				return nil, err
+			}
+			if namespace == metav1.NamespaceNone {
+				// objects of cluster-scoped resources are keyed without namespace
+				return informer.Lister().Get(name)
+			}
+			return informer.Lister().ByNamespace(namespace).Get(name)
+		},
+		listFunc: func(namespace string, selector labels.Selector, emit func(runtime.Object) bool) error {
+			informer, err := exec.getInformer(namespace)
+			if err != nil {
+				return err
+			}
+			objs, err := informer.Lister().ByNamespace(namespace).List(selector)
+			if err != nil {
+				return err
+			}
+			for _, obj := range objs {
+				if !emit(obj) {
+					return nil
+				}
+			}
+			return nil
+		},
+		liveGetFunc: func(namespace, name string) (runtime.Object, error) {
+			api := GetResouceIndexerInstance().GetAPIResource(rs)
+			u, err := exec.clientInterface.Resource(api, namespace).Get(name, metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			return castUnstructuredToObject(gvk, u)
 		},
-		listFunc: func(namespace string, selector labels.Selector) ([]runtime.Object, error) {
-			return exec.informer.Lister().ByNamespace(namespace).List(selector)
+		liveListFunc: func(namespace string, selector labels.Selector, emit func(runtime.Object) bool) error {
+			api := GetResouceIndexerInstance().GetAPIResource(rs)
+			return listWithDynamicClient(exec.clientInterface.Resource(api, namespace), gvk, selector, exec.pageSize, emit)
+		},
+		watchFunc: func(handler cache.ResourceEventHandler) (func(), error) {
+			watched, err := exec.getInformers(lambdaNamespaces)
+			if err != nil {
+				return nil, err
+			}
+			var unsubscribes []func()
+			for _, informer := range watched {
+				unsubscribes = append(unsubscribes, exec.dispatchers.dispatcherFor(informer.Informer()).subscribe(handler))
+			}
+			return func() {
+				for _, unsubscribe := range unsubscribes {
+					unsubscribe()
+				}
+			}, nil
 		},
 		createFunc: func(object runtime.Object) error {
 			api := GetResouceIndexerInstance().GetAPIResource(rs)
@@ -169,7 +499,7 @@ func (exec *kubernetesExecutable) InNamespace(namespaces ...string) *Lambda {
 			if _, err := exec.clientInterface.Resource(api, accessor.GetNamespace()).Create(tmpObj); err != nil {
 				return err
 			}
-			cache.WaitForCacheSync(make(chan struct{}), exec.informer.Informer().HasSynced)
+			exec.waitForCacheSync()
 			return nil
 		},
 		updateFunc: func(object runtime.Object) error {
@@ -186,40 +516,153 @@ func (exec *kubernetesExecutable) InNamespace(namespaces ...string) *Lambda {
 			if _, err := exec.clientInterface.Resource(api, accessor.GetNamespace()).Update(tmpObj); err != nil {
 				return err
 			}
-			cache.WaitForCacheSync(make(chan struct{}), exec.informer.Informer().HasSynced)
+			exec.waitForCacheSync()
+			return nil
+		},
+		deleteFunc: func(object runtime.Object, opts *metav1.DeleteOptions) error {
+			api := GetResouceIndexerInstance().GetAPIResource(rs)
+			accessor, err := meta.Accessor(object)
+			if err != nil {
+				return err
+			}
+			if err := exec.clientInterface.Resource(api, accessor.GetNamespace()).Delete(accessor.GetName(), opts); err != nil {
+				return err
+			}
+			exec.waitForCacheSync()
+			return nil
+		},
+		patchFunc: func(object runtime.Object, patchType types.PatchType, data []byte) error {
+			api := GetResouceIndexerInstance().GetAPIResource(rs)
+			accessor, err := meta.Accessor(object)
+			if err != nil {
+				return err
+			}
+			if _, err := exec.clientInterface.Resource(api, accessor.GetNamespace()).Patch(accessor.GetName(), patchType, data); err != nil {
+				return err
+			}
+			exec.waitForCacheSync()
 			return nil
 		},
-		deleteFunc: func(object runtime.Object) error {
+		applyFunc: func(object runtime.Object, fieldManager string, force bool) error {
 			api := GetResouceIndexerInstance().GetAPIResource(rs)
 			accessor, err := meta.Accessor(object)
 			if err != nil {
 				return err
 			}
-			if err := exec.clientInterface.Resource(api, accessor.GetNamespace()).Delete(accessor.GetName(), &metav1.DeleteOptions{}); err != nil {
+			object.GetObjectKind().SetGroupVersionKind(gvk)
+			if restClientErr != nil {
+				return restClientErr
+			}
+			if restClient != nil {
+				err = applyWithRESTClient(restClient, api, object, fieldManager, force)
+			} else {
+				err = applyWithDynamicClient(exec.clientInterface.Resource(api, accessor.GetNamespace()), object)
+			}
+			if err != nil {
 				return err
 			}
-			cache.WaitForCacheSync(make(chan struct{}), exec.informer.Informer().HasSynced)
+			exec.waitForCacheSync()
 			return nil
 		},
+		updateStatusFunc: func(object runtime.Object) error {
+			api := subresourceAPIResource(rs, SubresourceStatus)
+			accessor, err := meta.Accessor(object)
+			if err != nil {
+				return err
+			}
+			object.GetObjectKind().SetGroupVersionKind(gvk)
+			tmpObj, err := castObjectToUnstructured(object)
+			if err != nil {
+				return err
+			}
+			if _, err := exec.clientInterface.Resource(api, accessor.GetNamespace()).Update(tmpObj); err != nil {
+				return err
+			}
+			exec.waitForCacheSync()
+			return nil
+		},
+		patchStatusFunc: func(object runtime.Object, patchType types.PatchType, data []byte) error {
+			api := subresourceAPIResource(rs, SubresourceStatus)
+			accessor, err := meta.Accessor(object)
+			if err != nil {
+				return err
+			}
+			if _, err := exec.clientInterface.Resource(api, accessor.GetNamespace()).Patch(accessor.GetName(), patchType, data); err != nil {
+				return err
+			}
+			exec.waitForCacheSync()
+			return nil
+		},
+		evictFunc: func(object runtime.Object, opts *metav1.DeleteOptions) error {
+			accessor, err := meta.Accessor(object)
+			if err != nil {
+				return err
+			}
+			eviction, err := newEviction(accessor.GetNamespace(), accessor.GetName(), opts)
+			if err != nil {
+				return err
+			}
+			api := subresourceAPIResource(rs, SubresourceEviction)
+			if _, err := exec.clientInterface.Resource(api, accessor.GetNamespace()).Create(eviction); err != nil {
+				return err
+			}
+			exec.waitForCacheSync()
+			return nil
+		},
+		scaleFunc: func(object runtime.Object, replicas func(int32) int32) error {
+			accessor, err := meta.Accessor(object)
+			if err != nil {
+				return err
+			}
+			client := exec.clientInterface.Resource(scaleAPIResource(rs), accessor.GetNamespace())
+			if err := scaleWithDynamicClient(client, accessor.GetName(), replicas); err != nil {
+				return err
+			}
+			exec.waitForCacheSync()
+			return nil
+		},
+	}
+	if restClient != nil {
+		l.serverDryRunFunc = func(verb string, object runtime.Object, patchType types.PatchType, data []byte, params map[string]string) error {
+			api := GetResouceIndexerInstance().GetAPIResource(rs)
+			return dryRunWithRESTClient(restClient, api, verb, object, patchType, data, params)
+		}
 	}
 	close(ch)
 
 	return l
 }
 
-func (exec *kubernetesExecutable) OnAdd(f func(interface{})) {
-	exec.informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+// addEventHandler registers the handler to the informers, or returns the error if they fail
+// to start or sync
+func (exec *kubernetesExecutable) addEventHandler(handler cache.ResourceEventHandler) error {
+	watched, err := exec.getInformers(exec.defaultNamespaces())
+	if err != nil {
+		return err
+	}
+	for _, informer := range watched {
+		informer.Informer().AddEventHandler(handler)
+	}
+	return nil
+}
+
+// OnAdd registers the function called when an object is added to the local cache
+func (exec *kubernetesExecutable) OnAdd(f func(interface{})) error {
+	return exec.addEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: f,
 	})
 }
 
-func (exec *kubernetesExecutable) OnUpdate(f func(interface{}, interface{})) {
-	exec.informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+// OnUpdate registers the function called when an object is updated in the local cache
+func (exec *kubernetesExecutable) OnUpdate(f func(interface{}, interface{})) error {
+	return exec.addEventHandler(cache.ResourceEventHandlerFuncs{
 		UpdateFunc: f,
 	})
 }
-func (exec *kubernetesExecutable) OnDelete(f func(interface{})) {
-	exec.informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+
+// OnDelete registers the function called when an object is removed from the local cache
+func (exec *kubernetesExecutable) OnDelete(f func(interface{})) error {
+	return exec.addEventHandler(cache.ResourceEventHandlerFuncs{
 		DeleteFunc: f,
 	})
 }
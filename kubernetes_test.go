@@ -1,9 +1,23 @@
 package lambda
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
 func TestVersionParse(t *testing.T) {
@@ -25,3 +39,183 @@ func TestVersionParse(t *testing.T) {
 		assert.Equal(t, testCase.suffix, v.GetSuffix(), "suffix wrong")
 	}
 }
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: {{name}}
+  cluster:
+    server: https://{{name}}.example.com
+users:
+- name: {{name}}
+  user:
+    token: {{name}}-token
+contexts:
+- name: {{name}}
+  context:
+    cluster: {{name}}
+    user: {{name}}
+    namespace: {{name}}-ns
+current-context: {{name}}
+`
+
+func writeTestKubeconfig(t *testing.T, name string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(strings.ReplaceAll(testKubeconfig, "{{name}}", name)), 0600)
+	assert.NoError(t, err, "some error")
+	return path
+}
+
+func TestOutOfCluster(t *testing.T) {
+	foo := writeTestKubeconfig(t, "foo")
+	bar := writeTestKubeconfig(t, "bar")
+
+	kcl, err := OutOfCluster(LoadOptions{Paths: []string{foo, bar}})
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, "https://foo.example.com", kcl.GetRestConfig().Host, "former file not preferred")
+	assert.Equal(t, "foo-ns", kcl.GetDefaultNamespace(), "namespace wrong")
+
+	kcl, err = OutOfCluster(LoadOptions{Paths: []string{foo, bar}, Context: "bar"})
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, "https://bar.example.com", kcl.GetRestConfig().Host, "context not switched")
+	assert.Equal(t, "bar-token", kcl.GetRestConfig().BearerToken, "user wrong")
+	assert.Equal(t, "bar-ns", kcl.GetDefaultNamespace(), "namespace wrong")
+
+	t.Setenv(clientcmd.RecommendedConfigPathEnvVar, strings.Join([]string{bar, foo}, string(os.PathListSeparator)))
+	kcl, err = OutOfCluster(LoadOptions{
+		Overrides: &clientcmd.ConfigOverrides{
+			Context: clientcmdapi.Context{Namespace: "overridden"},
+		},
+	})
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, "https://bar.example.com", kcl.GetRestConfig().Host, "KUBECONFIG not respected")
+	assert.Equal(t, "overridden", kcl.GetDefaultNamespace(), "overrides not passed through")
+	kcl = OutOfClusterDefaultWithOptions(WithUserAgent("foo-agent"))
+	assert.Equal(t, "https://bar.example.com", kcl.GetRestConfig().Host, "KUBECONFIG not respected")
+	assert.Equal(t, "foo-agent", kcl.GetRestConfig().UserAgent, "options not applied")
+	kcl = OutOfClusterInContextWithOptions("foo", WithUserAgent("foo-agent"))
+	assert.Equal(t, "https://foo.example.com", kcl.GetRestConfig().Host, "context not switched")
+	assert.Equal(t, "foo-agent", kcl.GetRestConfig().UserAgent, "options not applied")
+
+	_, err = OutOfCluster(LoadOptions{Paths: []string{foo}, Context: "missing"})
+	assert.Error(t, err, "missing context loaded")
+
+	assert.Equal(t, "default", Mock().GetDefaultNamespace(), "mock namespace wrong")
+}
+
+func TestConstructorErrors(t *testing.T) {
+	kcl, err := NewForConfig(&rest.Config{Host: "https://foo.example.com"})
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, "https://foo.example.com", kcl.GetRestConfig().Host, "config wrong")
+
+	_, err = NewForConfig(&rest.Config{Host: "https://[foo"})
+	assert.Error(t, err, "invalid config accepted")
+	assert.Panics(t, func() {
+		MustNewForConfig(&rest.Config{Host: "https://[foo"})
+	}, "not panicked")
+
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		_, err = InCluster()
+		assert.Error(t, err, "in cluster outside of cluster")
+		assert.Panics(t, func() {
+			MustInCluster()
+		}, "not panicked")
+	}
+
+	mock := Mock()
+	_, err = mock.TypeE(Resource{"Foos", ""})
+	assert.Error(t, err, "unknown resource accepted")
+	assert.Panics(t, func() {
+		mock.Type(Resource{"Foos", ""})
+	}, "not panicked")
+	_, err = OfE[*corev1.Pod](mock, Resource{"Foos", ""})
+	assert.Error(t, err, "unknown resource accepted")
+	exec, err := mock.TypeE(Pod)
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, Pod, exec.Rs, "resource wrong")
+
+	_, err = mock.Type(Pod).InNamespace().List().Children(Resource{"Foos", ""}).Count()
+	assert.Error(t, err, "unknown resource accepted")
+}
+
+func TestClientOptions(t *testing.T) {
+	config := &rest.Config{Host: "https://foo.example.com"}
+	kcl, err := NewForConfig(config,
+		WithResync(time.Hour),
+		WithQPS(50, 100),
+		WithUserAgent("foo-agent"),
+		WithCacheSyncTimeout(time.Second),
+	)
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, float32(50), kcl.GetRestConfig().QPS, "qps not applied")
+	assert.Equal(t, 100, kcl.GetRestConfig().Burst, "burst not applied")
+	assert.Equal(t, "foo-agent", kcl.GetRestConfig().UserAgent, "user agent not applied")
+	assert.Equal(t, time.Second, kcl.(*kubernetesClientLambdaImpl).cacheSyncTimeout, "timeout not applied")
+	assert.Equal(t, "", config.UserAgent, "given config modified")
+
+	mock := MockWithOptions([]Option{
+		WithInformerTweak(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = "app=foo"
+		}),
+		WithCacheSyncTimeout(time.Second),
+	},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", Labels: map[string]string{"app": "foo"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "bar", Labels: map[string]string{"app": "bar"}}},
+	)
+	count, err := mock.Type(Pod).InNamespace("default").List().Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 1, count, "tweak not applied to informer")
+}
+
+func TestNamespacedInformers(t *testing.T) {
+	pod := func(namespace, name, app string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: map[string]string{"app": app}}}
+	}
+	mock := MockWithOptions([]Option{
+		WithNamespace("foo", "bar"),
+		WithLabelSelector("app=web"),
+	},
+		pod("foo", "a", "web"),
+		pod("foo", "b", "db"),
+		pod("bar", "c", "web"),
+		pod("baz", "d", "web"),
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"app": "web"}}},
+	)
+	fakes := mock.(*kubernetesClientLambdaImpl).clientPool.(*FakeClientPool)
+
+	count, err := mock.Type(Pod).InNamespace().List().Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 2, count, "not restricted to the namespaces and selector")
+	count, err = mock.Type(Pod).InNamespace("foo").List().Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 1, count, "namespace wrong")
+	count, err = mock.Type(Pod).InNamespace(metav1.NamespaceAll).List().Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 2, count, "not restricted to the namespaces")
+	_, err = mock.Type(Pod).InNamespace("baz").List().Count()
+	assert.Error(t, err, "unwatched namespace read")
+	for _, action := range fakes.Actions() {
+		if action.GetResource().Resource == "pods" {
+			assert.Contains(t, []string{"foo", "bar"}, action.GetNamespace(), "watched outside the namespaces")
+		}
+	}
+
+	count, err = mock.Type(Node).InNamespace().List().Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 1, count, "cluster-scoped resource not cached")
+
+	_, err = NewForConfig(&rest.Config{Host: "https://foo.example.com"}, WithLabelSelector("app in ("))
+	assert.Error(t, err, "invalid selector accepted")
+	assert.Panics(t, func() {
+		MockWithOptions([]Option{WithLabelSelector("app in (")})
+	}, "not panicked")
+}
+
+func TestEventHandlerErrors(t *testing.T) {
+	mock := MockWithOptions([]Option{WithCacheSyncTimeout(200 * time.Millisecond)})
+	mock.(*kubernetesClientLambdaImpl).clientPool.(*FakeClientPool).PrependReactor("list", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "", fmt.Errorf("forbidden"))
+	})
+	err := mock.Type(ConfigMap).OnAdd(func(interface{}) {})
+	assert.Error(t, err, "cache sync timeout not reported")
+}
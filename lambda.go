@@ -1,15 +1,22 @@
 package lambda
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"reflect"
 	"strings"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/jsonpath"
 )
 
 // Predicate is a function has only one parameter and return boolean.
@@ -30,6 +37,18 @@ type Function interface{}
 // Producer is recommeneded to be a closure so that the returning value can be controlled outside lambda.
 type Producer interface{}
 
+// Comparator is a function has two parameters of the same type and returns boolean.
+// Comparator reports whether the first parameter should be ordered before the second one.
+type Comparator interface{}
+
+// KeyFunction is a function has one parameter and returns a string.
+// KeyFunction is always used to classify elements into groups.
+type KeyFunction interface{}
+
+// Accumulator is a function has two parameters and returns a value of the same type as the first one.
+// The first parameter is the accumulated value and the second one is an element.
+type Accumulator interface{}
+
 func callPredicate(f interface{}, arg interface{}) bool {
 	if isZeroOfUnderlyingType(arg) {
 		panic(fmt.Sprintf("nil argument detected when calling predicate %#v with arg %#v", f, arg))
@@ -62,6 +81,43 @@ func callConsumer(f interface{}, arg interface{}) interface{} {
 	return ret[0].Interface()
 }
 
+func callComparator(f interface{}, a, b interface{}) bool {
+	if isZeroOfUnderlyingType(a) || isZeroOfUnderlyingType(b) {
+		panic(fmt.Sprintf("nil argument detected when calling comparator %#v with args %#v, %#v", f, a, b))
+	}
+	ret := reflect.ValueOf(f).Call([]reflect.Value{
+		reflect.ValueOf(a),
+		reflect.ValueOf(b),
+	})
+	return ret[0].Bool()
+}
+
+func callKeyFunction(f interface{}, arg interface{}) string {
+	if isZeroOfUnderlyingType(arg) {
+		panic(fmt.Sprintf("nil argument detected when calling key function %#v with arg %#v", f, arg))
+	}
+	ret := reflect.ValueOf(f).Call([]reflect.Value{
+		reflect.ValueOf(arg),
+	})
+	return ret[0].String()
+}
+
+func callAccumulator(f interface{}, acc interface{}, arg interface{}) interface{} {
+	if isZeroOfUnderlyingType(arg) {
+		panic(fmt.Sprintf("nil argument detected when calling accumulator %#v with arg %#v", f, arg))
+	}
+	accType := reflect.TypeOf(f).In(0)
+	accValue := reflect.Zero(accType)
+	if acc != nil {
+		accValue = reflect.ValueOf(acc)
+	}
+	ret := reflect.ValueOf(f).Call([]reflect.Value{
+		accValue,
+		reflect.ValueOf(arg),
+	})
+	return ret[0].Interface()
+}
+
 func callProducer(f interface{}) interface{} {
 	ret := reflect.ValueOf(f).Call([]reflect.Value{})
 	if isZeroOfUnderlyingType(ret[0].Interface()) {
@@ -71,60 +127,151 @@ func callProducer(f interface{}) interface{} {
 }
 
 // Lambda is a basic and core type of KCL. It holds a channel for receiving elements from previous
-// lambda or kubernetes resource fetcher. Error is assigned if any error occured during lambda
-// pipelining. The error will be recorded but the lambda pipelining will continue on, and forcing it
-// fail-hard needs call MustNoError method. The error can be also be returned at the end of a pipeline
-// via lambda operation method which is defined in lambda_operation.go
+// lambda or kubernetes resource fetcher. Error is recorded to the error chain shared by every
+// lambda of the pipeline if any error occured during lambda pipelining. The error will be recorded
+// but the lambda pipelining will continue on, and forcing it fail-hard needs call MustNoError
+// method. The error can be also be returned at the end of a pipeline via lambda operation method
+// which is defined in lambda_operation.go
 type Lambda struct {
-	getFunc    func(namespace, name string) (runtime.Object, error)
-	listFunc   func(namespace string, selector labels.Selector) ([]runtime.Object, error)
-	createFunc func(runtime.Object) error
-	updateFunc func(runtime.Object) error
-	deleteFunc func(runtime.Object) error
+	getFunc func(namespace, name string) (runtime.Object, error)
+	// listFunc emits the objects listed until emit returns false
+	listFunc func(namespace string, selector labels.Selector, emit func(runtime.Object) bool) error
+	// liveGetFunc and liveListFunc read from apiserver bypassing the local cache
+	liveGetFunc  func(namespace, name string) (runtime.Object, error)
+	liveListFunc func(namespace string, selector labels.Selector, emit func(runtime.Object) bool) error
+	createFunc   func(runtime.Object) error
+	updateFunc   func(runtime.Object) error
+	deleteFunc   func(runtime.Object, *metav1.DeleteOptions) error
+	patchFunc    func(runtime.Object, types.PatchType, []byte) error
+	applyFunc    func(object runtime.Object, fieldManager string, force bool) error
+	scaleFunc    func(object runtime.Object, replicas func(current int32) int32) error
+	// updateStatusFunc and patchStatusFunc target the status subresource
+	updateStatusFunc func(runtime.Object) error
+	patchStatusFunc  func(runtime.Object, types.PatchType, []byte) error
+	// evictFunc evicts the pod through the eviction subresource
+	evictFunc func(runtime.Object, *metav1.DeleteOptions) error
+	// watchFunc subscribes the handler to the events of the resource until unsubscribed
+	watchFunc func(cache.ResourceEventHandler) (unsubscribe func(), err error)
+
+	serverDryRunFunc func(verb string, object runtime.Object, patchType types.PatchType, data []byte, params map[string]string) error
 
 	clientInterface dynamic.Interface
+	kcl             KubernetesClientLambda
 	rs              Resource
 	namespaces      []string
+	ctx             context.Context
 	val             <-chan runtime.Object
-	Errors          []error
+	errs            *errorChain
+	plan            *Plan
 }
 
 func (lambda *Lambda) run(f func()) error {
 	if !lambda.NoError() {
+		drain(lambda.val)
 		return &ErrMultiLambdaFailure{
-			errors: lambda.Errors,
+			errors: lambda.Errors(),
 		}
 	}
+	if err := lambda.ctx.Err(); err != nil {
+		drain(lambda.val)
+		return err
+	}
 	f()
-	if len(lambda.Errors) != 0 {
+	if err := lambda.ctx.Err(); err != nil {
+		return err
+	}
+	if !lambda.NoError() {
 		return &ErrMultiLambdaFailure{
-			errors: lambda.Errors,
+			errors: lambda.Errors(),
 		}
 	}
 	return nil
 }
 
 func (lambda *Lambda) addError(err error) {
-	if lambda.Errors == nil {
-		lambda.Errors = []error{err}
+	lambda.errs.add(err)
+}
+
+func (lambda *Lambda) addObjectError(verb string, object runtime.Object, err error) {
+	objErr := &ObjectError{
+		Resource: lambda.rs,
+		Verb:     verb,
+		Err:      err,
 	}
-	lambda.Errors = append(lambda.Errors, err)
+	if accessor, accessorErr := meta.Accessor(object); accessorErr == nil {
+		objErr.Namespace = accessor.GetNamespace()
+		objErr.Name = accessor.GetName()
+	}
+	lambda.addError(objErr)
+}
+
+// Errors returns errors occured in the lambda pipeline so far. It replaces the former Errors
+// field, which the stages running in their own goroutines appended to copies of.
+func (lambda *Lambda) Errors() []error {
+	return lambda.errs.list()
 }
 
 func (lambda *Lambda) clone() (*Lambda, chan runtime.Object) {
 	ch := make(chan runtime.Object)
-	l := &Lambda{
-		rs:              lambda.rs,
-		val:             ch,
-		Errors:          lambda.Errors,
-		getFunc:         lambda.getFunc,
-		listFunc:        lambda.listFunc,
-		createFunc:      lambda.createFunc,
-		updateFunc:      lambda.updateFunc,
-		deleteFunc:      lambda.deleteFunc,
-		clientInterface: lambda.clientInterface,
+	// the clone shares everything but the channel of elements, so that no func is left behind
+	l := *lambda
+	l.val = ch
+	return &l, ch
+}
+
+// forEach receives elements from the lambda until the channel is closed, the context
+// is done or f returns false. Elements left behind are drained in the background so
+// that upstream stages never block forever on sending.
+func (lambda *Lambda) forEach(f func(item runtime.Object) bool) {
+	defer drain(lambda.val)
+	for {
+		select {
+		case <-lambda.ctx.Done():
+			return
+		case item, ok := <-lambda.val:
+			if !ok || !f(item) {
+				return
+			}
+		}
+	}
+}
+
+// send puts the element to the channel unless the context is done.
+// Returns false if the element is dropped.
+func (lambda *Lambda) send(ch chan<- runtime.Object, item runtime.Object) bool {
+	select {
+	case <-lambda.ctx.Done():
+		return false
+	case ch <- item:
+		return true
 	}
-	return l, ch
+}
+
+func drain(ch <-chan runtime.Object) {
+	go func() {
+		for range ch {
+		}
+	}()
+}
+
+// WithContext binds the context to the lambda and every lambda derived from it.
+// Once the context is cancelled or its deadline exceeds, every stage stops and
+// lambda operations return the context's error.
+func (lambda *Lambda) WithContext(ctx context.Context) *Lambda {
+	l, ch := lambda.clone()
+	l.ctx = ctx
+	go func() {
+		defer close(ch)
+		lambda.forEach(func(item runtime.Object) bool {
+			return l.send(ch, item)
+		})
+	}()
+	return l
+}
+
+// Context returns the context bound to the lambda
+func (lambda *Lambda) Context() context.Context {
+	return lambda.ctx
 }
 
 //********************************************************
@@ -136,13 +283,14 @@ func (lambda *Lambda) Collect() *Lambda {
 	l, ch := lambda.clone()
 	go func() {
 		defer close(ch)
-		for item := range lambda.val {
-			if obj, ok := item.(runtime.Object); !ok {
+		lambda.forEach(func(item runtime.Object) bool {
+			obj, ok := item.(runtime.Object)
+			if !ok {
 				l.addError(fmt.Errorf("Invalid object type of %#v", obj))
-			} else {
-				ch <- obj.DeepCopyObject()
+				return true
 			}
-		}
+			return l.send(ch, obj.DeepCopyObject())
+		})
 	}()
 	return l
 }
@@ -154,16 +302,16 @@ func (lambda *Lambda) LatestCreated() *Lambda {
 		defer close(ch)
 		var latestObj runtime.Object
 		var latestTimestamp *time.Time
-		for item := range lambda.val {
-			item := item
+		lambda.forEach(func(item runtime.Object) bool {
 			accessor, _ := meta.Accessor(item)
 			if latestTimestamp == nil || accessor.GetCreationTimestamp().Time.After(*latestTimestamp) {
 				t := accessor.GetCreationTimestamp().Time
 				latestTimestamp = &t
 				latestObj = item
 			}
-		}
-		ch <- latestObj
+			return true
+		})
+		l.send(ch, latestObj)
 	}()
 	return l
 }
@@ -172,8 +320,12 @@ func (lambda *Lambda) LatestCreated() *Lambda {
 // exists in the lambda pipeline, a random object may be returned.
 func (lambda *Lambda) Element() (runtime.Object, error) {
 	var element runtime.Object
-	for item := range lambda.val {
+	lambda.forEach(func(item runtime.Object) bool {
 		element = item
+		return true
+	})
+	if err := lambda.ctx.Err(); err != nil {
+		return nil, err
 	}
 	if element == nil {
 		return nil, fmt.Errorf("no element found")
@@ -184,9 +336,12 @@ func (lambda *Lambda) Element() (runtime.Object, error) {
 // Elements returns all elements from the lambda pipeline.
 func (lambda *Lambda) Elements() ([]runtime.Object, error) {
 	var elements []runtime.Object
-	for item := range lambda.val {
-		item := item
+	lambda.forEach(func(item runtime.Object) bool {
 		elements = append(elements, item)
+		return true
+	})
+	if err := lambda.ctx.Err(); err != nil {
+		return nil, err
 	}
 	if len(elements) == 0 {
 		return nil, fmt.Errorf("no elements found")
@@ -200,29 +355,43 @@ func (lambda *Lambda) Elements() ([]runtime.Object, error) {
 
 // First returnes the first element matches the predicate
 func (lambda *Lambda) First(predicate Predicate) *Lambda {
+	return lambda.first(func(item runtime.Object) bool {
+		return callPredicate(predicate, item)
+	})
+}
+
+func (lambda *Lambda) first(predicate func(runtime.Object) bool) *Lambda {
 	l, ch := lambda.clone()
 	go func() {
 		defer close(ch)
-		for item := range lambda.val {
-			if callPredicate(predicate, item) {
-				ch <- item
-				break
+		lambda.forEach(func(item runtime.Object) bool {
+			if predicate(item) {
+				l.send(ch, item)
+				return false
 			}
-		}
+			return true
+		})
 	}()
 	return l
 }
 
 // Grep returnes the elements matches the predicate
 func (lambda *Lambda) Grep(predicate Predicate) *Lambda {
+	return lambda.grep(func(item runtime.Object) bool {
+		return callPredicate(predicate, item)
+	})
+}
+
+func (lambda *Lambda) grep(predicate func(runtime.Object) bool) *Lambda {
 	l, ch := lambda.clone()
 	go func() {
 		defer close(ch)
-		for item := range lambda.val {
-			if callPredicate(predicate, item) {
-				ch <- item
+		lambda.forEach(func(item runtime.Object) bool {
+			if predicate(item) {
+				return l.send(ch, item)
 			}
-		}
+			return true
+		})
 	}()
 	return l
 }
@@ -233,14 +402,21 @@ func (lambda *Lambda) Grep(predicate Predicate) *Lambda {
 
 // Map transforms and replace the elements and put them to the next lambda
 func (lambda *Lambda) Map(consumer Consumer) *Lambda {
+	return lambda.mapping(func(item runtime.Object) runtime.Object {
+		return callConsumer(consumer, item).(runtime.Object)
+	})
+}
+
+func (lambda *Lambda) mapping(consumer func(runtime.Object) runtime.Object) *Lambda {
 	l, ch := lambda.clone()
 	go func() {
 		defer close(ch)
-		for item := range lambda.val {
-			if v := callConsumer(consumer, item); v != nil {
-				ch <- v.(runtime.Object)
+		lambda.forEach(func(item runtime.Object) bool {
+			if v := consumer(item); v != nil {
+				return l.send(ch, v)
 			}
-		}
+			return true
+		})
 	}()
 	return l
 }
@@ -252,13 +428,19 @@ func (lambda *Lambda) Map(consumer Consumer) *Lambda {
 // Iter iterates the elements and apply function to them
 // Note that modifying is not recommened in Iter, use Map to modify elements instead
 func (lambda *Lambda) Iter(function Function) *Lambda {
+	return lambda.iter(func(item runtime.Object) {
+		callFunction(function, item)
+	})
+}
+
+func (lambda *Lambda) iter(function func(runtime.Object)) *Lambda {
 	l, ch := lambda.clone()
 	go func() {
 		defer close(ch)
-		for item := range lambda.val {
-			callFunction(function, item)
-			ch <- item
-		}
+		lambda.forEach(func(item runtime.Object) bool {
+			function(item)
+			return l.send(ch, item)
+		})
 	}()
 	return l
 }
@@ -269,14 +451,23 @@ func (lambda *Lambda) Iter(function Function) *Lambda {
 
 // Add calls the producer and put the returned value into elements
 func (lambda *Lambda) Add(producer Producer) *Lambda {
+	return lambda.add(func() runtime.Object {
+		return callProducer(producer).(runtime.Object)
+	})
+}
+
+func (lambda *Lambda) add(producer func() runtime.Object) *Lambda {
 	l, ch := lambda.clone()
 	go func() {
 		defer close(ch)
-		for item := range lambda.val {
-			ch <- item
+		lambda.forEach(func(item runtime.Object) bool {
+			return l.send(ch, item)
+		})
+		if lambda.ctx.Err() != nil {
+			return
 		}
-		if v := callProducer(producer); v != nil {
-			ch <- v.(runtime.Object)
+		if v := producer(); v != nil {
+			l.send(ch, v)
 		}
 	}()
 	return l
@@ -355,7 +546,7 @@ func (lambda *Lambda) HasLabel(key, value string) *Lambda {
 		if err != nil {
 			return false
 		}
-		return accessor.GetLabels()[key] != value
+		return accessor.GetLabels()[key] == value
 	})
 }
 
@@ -369,3 +560,121 @@ func (lambda *Lambda) HasLabelKey(key string) *Lambda {
 		return accessor.GetLabels()[key] != ""
 	})
 }
+
+// MatchSelector filter the elements out if its labels don't match the selector string,
+// e.g. MatchSelector("app in (web,api),!canary")
+func (lambda *Lambda) MatchSelector(selector string) *Lambda {
+	s, err := labels.Parse(selector)
+	if err != nil {
+		lambda.addError(err)
+		s = labels.Nothing()
+	}
+	return lambda.matchSelector(s)
+}
+
+// MatchLabelSelector filter the elements out if its labels don't match the label selector
+func (lambda *Lambda) MatchLabelSelector(selector *metav1.LabelSelector) *Lambda {
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		lambda.addError(err)
+		s = labels.Nothing()
+	}
+	return lambda.matchSelector(s)
+}
+
+func (lambda *Lambda) matchSelector(selector labels.Selector) *Lambda {
+	return lambda.grep(func(object runtime.Object) bool {
+		accessor, err := meta.Accessor(object)
+		if err != nil {
+			return false
+		}
+		return selector.Matches(labels.Set(accessor.GetLabels()))
+	})
+}
+
+// toUnstructured converts the element to unstructured object. Kind of the
+// lambda resource is set if the element comes with an empty type meta.
+func (lambda *Lambda) toUnstructured(object runtime.Object) (*unstructured.Unstructured, error) {
+	if u, ok := object.(*unstructured.Unstructured); ok {
+		return u, nil
+	}
+	if object.GetObjectKind().GroupVersionKind().Empty() {
+		object = object.DeepCopyObject()
+		object.GetObjectKind().SetGroupVersionKind(GetResouceIndexerInstance().GetGroupVersionKind(lambda.rs))
+	}
+	return castObjectToUnstructured(object)
+}
+
+// fieldValue returns the string form of the field under the dot-separated path
+func (lambda *Lambda) fieldValue(object runtime.Object, path string) (string, bool) {
+	u, err := lambda.toUnstructured(object)
+	if err != nil {
+		lambda.addError(err)
+		return "", false
+	}
+	value, found, err := unstructured.NestedFieldCopy(u.Object, strings.Split(path, ".")...)
+	if err != nil || !found || value == nil {
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+// FieldEqual filter the elements out if the field under the dot-separated path mismatches the value,
+// e.g. FieldEqual("spec.nodeName", "node-1")
+func (lambda *Lambda) FieldEqual(path, value string) *Lambda {
+	return lambda.grep(func(object runtime.Object) bool {
+		v, found := lambda.fieldValue(object, path)
+		return found && v == value
+	})
+}
+
+// FieldExists filter the elements out if it doesn't have the field under the dot-separated path
+func (lambda *Lambda) FieldExists(path string) *Lambda {
+	return lambda.grep(func(object runtime.Object) bool {
+		_, found := lambda.fieldValue(object, path)
+		return found
+	})
+}
+
+// FieldRegex filter the elements out if the field under the dot-separated path fails to matches the regexp
+func (lambda *Lambda) FieldRegex(path, regex string) *Lambda {
+	return lambda.grep(func(object runtime.Object) bool {
+		v, found := lambda.fieldValue(object, path)
+		if !found {
+			return false
+		}
+		matched, err := regexMatch(v, regex)
+		if err != nil {
+			lambda.addError(err)
+			return false
+		}
+		return matched
+	})
+}
+
+// JSONPath filter the elements out if the result of the jsonpath expression mismatches the expected,
+// e.g. JSONPath("{.status.phase}", "Running")
+func (lambda *Lambda) JSONPath(expr, expected string) *Lambda {
+	if !strings.HasPrefix(expr, "{") {
+		expr = "{" + expr + "}"
+	}
+	parser := jsonpath.New("kcl").AllowMissingKeys(true)
+	if err := parser.Parse(expr); err != nil {
+		lambda.addError(err)
+		return lambda.grep(func(object runtime.Object) bool {
+			return false
+		})
+	}
+	return lambda.grep(func(object runtime.Object) bool {
+		u, err := lambda.toUnstructured(object)
+		if err != nil {
+			lambda.addError(err)
+			return false
+		}
+		buffer := new(bytes.Buffer)
+		if err := parser.Execute(buffer, u.Object); err != nil {
+			return false
+		}
+		return buffer.String() == expected
+	})
+}
@@ -3,15 +3,19 @@ package lambda
 import (
 	"fmt"
 	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // Dummy do nothing and passing the elements next
 func (lambda *Lambda) Dummy() *Lambda {
 	l, ch := lambda.clone()
 	go func() {
-		for item := range lambda.val {
-			ch <- item
-		}
+		defer close(ch)
+		lambda.forEach(func(item runtime.Object) bool {
+			return l.send(ch, item)
+		})
 	}()
 	return l
 }
@@ -19,14 +23,79 @@ func (lambda *Lambda) Dummy() *Lambda {
 // MustNoError panics if any error occured
 func (lambda *Lambda) MustNoError() *Lambda {
 	if !lambda.NoError() {
-		panic(lambda.Errors)
+		panic(lambda.Errors())
 	}
 	return lambda.Dummy()
 }
 
 // NoError checks if any error occured before
 func (lambda *Lambda) NoError() bool {
-	return lambda.Errors == nil || len(lambda.Errors) == 0
+	return len(lambda.Errors()) == 0
+}
+
+// errorChain collects errors from every lambda of a pipeline
+type errorChain struct {
+	lock   sync.Mutex
+	errors []error
+}
+
+func (c *errorChain) add(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.errors = append(c.errors, err)
+}
+
+func (c *errorChain) list() []error {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]error(nil), c.errors...)
+}
+
+// Verbs of kubernetes operation reported in ObjectError
+const (
+	VerbGet    = "get"
+	VerbList   = "list"
+	VerbCreate = "create"
+	VerbUpdate = "update"
+	VerbDelete = "delete"
+	VerbPatch  = "patch"
+	VerbApply  = "apply"
+	VerbScale  = "scale"
+	VerbEvict  = "evict"
+
+	VerbUpdateStatus = "update status"
+	VerbPatchStatus  = "patch status"
+
+	// VerbMap and VerbAdd report a nil element returned by the consumer of a typed Map
+	// or the producer of a typed Add
+	VerbMap = "map"
+	VerbAdd = "add"
+)
+
+// ObjectError is the error occured when applying the verb to an object.
+// Name is empty if the verb is applied to a namespace, e.g. list.
+type ObjectError struct {
+	Resource  Resource
+	Namespace string
+	Name      string
+	Verb      string
+	Err       error
+}
+
+func (e *ObjectError) Error() string {
+	target := e.Name
+	if e.Namespace != "" {
+		target = e.Namespace + "/" + e.Name
+	}
+	return fmt.Sprintf("failed to %s %s %s: %v", e.Verb, e.Resource.Name, target, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ObjectError) Unwrap() error {
+	return e.Err
 }
 
 // ErrMultiLambdaFailure contains one or more error occured from
@@ -35,6 +104,17 @@ type ErrMultiLambdaFailure struct {
 	errors []error
 }
 
+// Errors returns every error occured
+func (e ErrMultiLambdaFailure) Errors() []error {
+	return e.errors
+}
+
+// Unwrap returns every error occured so that errors.Is and errors.As
+// inspect each of them
+func (e ErrMultiLambdaFailure) Unwrap() []error {
+	return e.errors
+}
+
 func (e ErrMultiLambdaFailure) Error() string {
 	msgs := []string{}
 	for _, err := range e.errors {
@@ -0,0 +1,68 @@
+package lambda
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// Live makes the following lambdas read from apiserver instead of the local cache, so that
+// listing and getting don't start the informer of the resource nor observe stale objects.
+// Listing is paginated and every page is streamed into the pipeline once received.
+func (lambda *Lambda) Live() *Lambda {
+	l, ch := lambda.clone()
+	if l.liveGetFunc != nil && l.liveListFunc != nil {
+		l.getFunc = l.liveGetFunc
+		l.listFunc = l.liveListFunc
+	} else {
+		l.addError(fmt.Errorf("no live read for lambda of %s", l.rs.Name))
+	}
+	go func() {
+		defer close(ch)
+		lambda.forEach(func(item runtime.Object) bool {
+			return l.send(ch, item)
+		})
+	}()
+	return l
+}
+
+// listWithDynamicClient lists the objects page by page using limit and continue, emitting
+// the objects of each page before requesting the next one
+func listWithDynamicClient(client dynamic.ResourceInterface, gvk schema.GroupVersionKind, selector labels.Selector, limit int64, emit func(runtime.Object) bool) error {
+	if _, selectable := selector.Requirements(); !selectable {
+		// labels.Nothing can't be expressed in a selector string
+		return nil
+	}
+	opts := metav1.ListOptions{
+		LabelSelector: selector.String(),
+		Limit:         limit,
+	}
+	for {
+		obj, err := client.List(opts)
+		if err != nil {
+			return err
+		}
+		list, ok := obj.(*unstructured.UnstructuredList)
+		if !ok {
+			return fmt.Errorf("unexpected list type %T", obj)
+		}
+		for i := range list.Items {
+			item, err := castUnstructuredToObject(gvk, &list.Items[i])
+			if err != nil {
+				return err
+			}
+			if !emit(item) {
+				return nil
+			}
+		}
+		if list.GetContinue() == "" {
+			return nil
+		}
+		opts.Continue = list.GetContinue()
+	}
+}
@@ -0,0 +1,242 @@
+package lambda
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// mirrorPodAnnotation marks the static pods mirrored from kubelet, which can't be evicted
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+)
+
+var (
+	// drainRetryInterval is the interval of retrying evictions rejected by disruption budgets
+	drainRetryInterval = time.Second
+)
+
+// DrainOptions configures draining nodes
+type DrainOptions struct {
+	// GracePeriodSeconds overrides the grace period of the evicted pods if set
+	GracePeriodSeconds *int64
+	// Timeout is the maximum time to drain a node, no timeout if zero
+	Timeout time.Duration
+}
+
+// DrainError reports the pods which blocked draining the node
+type DrainError struct {
+	Node string
+	// Blocked are the pods in namespace/name format which couldn't be evicted
+	// or weren't gone in time
+	Blocked []string
+	// Errors are the errors occured evicting the pods, keyed by namespace/name
+	Errors map[string]error
+}
+
+func (e *DrainError) Error() string {
+	blocked := make([]string, 0, len(e.Blocked))
+	for _, key := range e.Blocked {
+		if err := e.Errors[key]; err != nil {
+			key = fmt.Sprintf("%s (%v)", key, err)
+		}
+		blocked = append(blocked, key)
+	}
+	return fmt.Sprintf("failed to drain node %s, blocked by pods: %s", e.Node, strings.Join(blocked, ", "))
+}
+
+// newEviction creates the eviction of the pod in unstructured
+func newEviction(namespace, name string, opts *metav1.DeleteOptions) (*unstructured.Unstructured, error) {
+	eviction := &policyv1beta1.Eviction{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Eviction",
+			APIVersion: policyv1beta1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+		DeleteOptions: opts,
+	}
+	return castObjectToUnstructured(eviction)
+}
+
+func (lambda *Lambda) checkNode() {
+	if lambda.rs != Node {
+		lambda.addError(fmt.Errorf("resource %s is not node", lambda.rs.Name))
+	}
+}
+
+func (lambda *Lambda) setUnschedulable(unschedulable bool) (patched bool, err error) {
+	lambda.checkNode()
+	data := []byte(fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable))
+	return lambda.Patch(types.MergePatchType, data)
+}
+
+// Cordon marks every node unschedulable
+func (lambda *Lambda) Cordon() (cordoned bool, err error) {
+	return lambda.setUnschedulable(true)
+}
+
+// Uncordon marks every node schedulable
+func (lambda *Lambda) Uncordon() (uncordoned bool, err error) {
+	return lambda.setUnschedulable(false)
+}
+
+// Drain cordons every node and evicts the pods on it through the eviction subresource, so that
+// PodDisruptionBudgets are honored. Evictions rejected by disruption budgets are retried until
+// the timeout. DaemonSet pods and mirror pods are left on the node. A DrainError listing the
+// pods blocking the drain is reported for each node failed.
+func (lambda *Lambda) Drain(opts DrainOptions) (drained bool, err error) {
+	lambda.checkNode()
+	err = lambda.run(
+		func() {
+			lambda.forEach(func(item runtime.Object) bool {
+				if err := lambda.patchFunc(item, types.MergePatchType, []byte(`{"spec":{"unschedulable":true}}`)); err != nil {
+					lambda.addObjectError(VerbPatch, item, err)
+					return true
+				}
+				accessor, err := meta.Accessor(item)
+				if err != nil {
+					lambda.addError(err)
+					return true
+				}
+				if err := lambda.drainNode(accessor.GetName(), opts); err != nil {
+					lambda.addError(err)
+					return true
+				}
+				drained = true
+				return true
+			})
+		},
+	)
+	return
+}
+
+// isDrainable checks if the pod on the node should be evicted
+func isDrainable(node string) func(runtime.Object) bool {
+	return func(item runtime.Object) bool {
+		pod, ok := item.(*corev1.Pod)
+		if !ok || pod.Spec.NodeName != node {
+			return false
+		}
+		if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+			return false
+		}
+		for _, ref := range pod.OwnerReferences {
+			if ref.Kind == "DaemonSet" {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func (lambda *Lambda) drainNode(node string, opts DrainOptions) error {
+	pods, ch, err := lambda.switchType(Pod)
+	if err != nil {
+		return err
+	}
+	close(ch)
+	// a node with nothing to evict is drained already
+	var targets []runtime.Object
+	drainable := isDrainable(node)
+	for _, namespace := range pods.namespaces {
+		err := pods.listFunc(namespace, labels.Everything(), func(item runtime.Object) bool {
+			if drainable(item) {
+				targets = append(targets, item)
+			}
+			return true
+		})
+		if err != nil {
+			return &ObjectError{
+				Resource:  Pod,
+				Namespace: namespace,
+				Verb:      VerbList,
+				Err:       err,
+			}
+		}
+	}
+	watcher, err := pods.watchDeletion()
+	if err != nil {
+		return err
+	}
+	defer watcher.stop()
+
+	// both retrying evictions and waiting for the pods to be gone count against the timeout
+	var deadline <-chan struct{}
+	if opts.Timeout > 0 {
+		var stop func()
+		deadline, stop = deadlineAfter(opts.Timeout)
+		defer stop()
+	}
+	drainErr := &DrainError{
+		Node:   node,
+		Errors: make(map[string]error),
+	}
+	var evicted []deletion
+	pending := targets
+	for len(pending) > 0 {
+		var retry []runtime.Object
+		for _, pod := range pending {
+			d, err := deletionOf(pod)
+			if err != nil {
+				return err
+			}
+			err = pods.evictFunc(pod, deleteOptionsFor(&metav1.DeleteOptions{GracePeriodSeconds: opts.GracePeriodSeconds}, pod))
+			switch {
+			case err == nil:
+				delete(drainErr.Errors, d.key.String())
+				evicted = append(evicted, d)
+			case apierrors.IsNotFound(err):
+				// gone already
+			case apierrors.IsTooManyRequests(err):
+				// rejected by disruption budget
+				drainErr.Errors[d.key.String()] = err
+				retry = append(retry, pod)
+			default:
+				drainErr.Blocked = append(drainErr.Blocked, d.key.String())
+				drainErr.Errors[d.key.String()] = err
+			}
+		}
+		pending = retry
+		if len(pending) == 0 {
+			break
+		}
+		select {
+		case <-lambda.ctx.Done():
+			return lambda.ctx.Err()
+		case <-deadline:
+			for _, pod := range pending {
+				d, _ := deletionOf(pod)
+				drainErr.Blocked = append(drainErr.Blocked, d.key.String())
+			}
+			pending = nil
+		case <-time.After(drainRetryInterval):
+		}
+	}
+
+	if lambda.plan == nil && len(evicted) > 0 {
+		remaining, _ := watcher.wait(evicted, deadline)
+		if err := lambda.ctx.Err(); err != nil {
+			return err
+		}
+		for _, d := range remaining {
+			drainErr.Blocked = append(drainErr.Blocked, d.key.String())
+		}
+	}
+	if len(drainErr.Blocked) > 0 {
+		return drainErr
+	}
+	return nil
+}
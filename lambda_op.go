@@ -5,11 +5,15 @@ import (
 	"sync"
 
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/retry"
 )
 
 //********************************************************
@@ -22,11 +26,12 @@ func (lambda *Lambda) NotEmpty() (noempty bool, err error) {
 	noempty = true
 	err = lambda.run(
 		func() {
-			for item := range lambda.val {
+			lambda.forEach(func(item runtime.Object) bool {
 				if item == nil {
 					noempty = false
 				}
-			}
+				return true
+			})
 		},
 	)
 	return
@@ -34,14 +39,21 @@ func (lambda *Lambda) NotEmpty() (noempty bool, err error) {
 
 // Every checks if every element get a true from predicate
 func (lambda *Lambda) Every(predicate Predicate) (every bool, err error) {
+	return lambda.every(func(item runtime.Object) bool {
+		return callPredicate(predicate, item)
+	})
+}
+
+func (lambda *Lambda) every(predicate func(runtime.Object) bool) (every bool, err error) {
 	every = true
 	err = lambda.run(
 		func() {
-			for item := range lambda.val {
-				if !callPredicate(predicate, item) {
+			lambda.forEach(func(item runtime.Object) bool {
+				if !predicate(item) {
 					every = false
 				}
-			}
+				return true
+			})
 		},
 	)
 	return
@@ -49,13 +61,20 @@ func (lambda *Lambda) Every(predicate Predicate) (every bool, err error) {
 
 // Any checks if any element get a true from predicate
 func (lambda *Lambda) Any(predicate Predicate) (any bool, err error) {
+	return lambda.any(func(item runtime.Object) bool {
+		return callPredicate(predicate, item)
+	})
+}
+
+func (lambda *Lambda) any(predicate func(runtime.Object) bool) (any bool, err error) {
 	err = lambda.run(
 		func() {
-			for item := range lambda.val {
-				if callPredicate(predicate, item) {
+			lambda.forEach(func(item runtime.Object) bool {
+				if predicate(item) {
 					any = true
 				}
-			}
+				return true
+			})
 		},
 	)
 	return
@@ -63,20 +82,140 @@ func (lambda *Lambda) Any(predicate Predicate) (any bool, err error) {
 
 // Each applies function to every element
 func (lambda *Lambda) Each(function Function) error {
+	return lambda.each(func(item runtime.Object) {
+		callFunction(function, item)
+	})
+}
+
+func (lambda *Lambda) each(function func(runtime.Object)) error {
 	return lambda.run(
 		func() {
-			for item := range lambda.val {
-				callFunction(function, item)
-			}
+			lambda.forEach(func(item runtime.Object) bool {
+				function(item)
+				return true
+			})
 		},
 	)
 }
 
+//********************************************************
+// Aggregation Operation
+//********************************************************
+
+// Count returns the number of elements
+func (lambda *Lambda) Count() (count int, err error) {
+	err = lambda.run(
+		func() {
+			lambda.forEach(func(item runtime.Object) bool {
+				count++
+				return true
+			})
+		},
+	)
+	return
+}
+
+// GroupBy classifies elements by the key returned from key function
+func (lambda *Lambda) GroupBy(keyFunction KeyFunction) (map[string][]runtime.Object, error) {
+	return lambda.groupBy(func(item runtime.Object) string {
+		return callKeyFunction(keyFunction, item)
+	})
+}
+
+func (lambda *Lambda) groupBy(keyFunction func(runtime.Object) string) (groups map[string][]runtime.Object, err error) {
+	groups = make(map[string][]runtime.Object)
+	err = lambda.run(
+		func() {
+			lambda.forEach(func(item runtime.Object) bool {
+				key := keyFunction(item)
+				groups[key] = append(groups[key], item)
+				return true
+			})
+		},
+	)
+	return
+}
+
+// GroupByLabel classifies elements by value of the label.
+// Elements without the label are grouped under empty string.
+func (lambda *Lambda) GroupByLabel(key string) (map[string][]runtime.Object, error) {
+	return lambda.groupBy(func(item runtime.Object) string {
+		accessor, err := meta.Accessor(item)
+		if err != nil {
+			return ""
+		}
+		return accessor.GetLabels()[key]
+	})
+}
+
+// GroupByNamespace classifies elements by their namespace
+func (lambda *Lambda) GroupByNamespace() (map[string][]runtime.Object, error) {
+	return lambda.groupBy(func(item runtime.Object) string {
+		accessor, err := meta.Accessor(item)
+		if err != nil {
+			return ""
+		}
+		return accessor.GetNamespace()
+	})
+}
+
+// Reduce folds elements into one value by applying the accumulator to every element.
+// The initial value is passed to the accumulator with the first element.
+func (lambda *Lambda) Reduce(initial interface{}, accumulator Accumulator) (result interface{}, err error) {
+	result = initial
+	err = lambda.run(
+		func() {
+			lambda.forEach(func(item runtime.Object) bool {
+				result = callAccumulator(accumulator, result, item)
+				return true
+			})
+		},
+	)
+	return
+}
+
+// Partition splits the elements into two lambdas by the predicate. Note that
+// every element is buffered until upstream finishes, and both of lambdas should
+// be consumed or its context be cancelled, otherwise the unconsumed one leaks.
+func (lambda *Lambda) Partition(predicate Predicate) (matched, unmatched *Lambda) {
+	return lambda.partition(func(item runtime.Object) bool {
+		return callPredicate(predicate, item)
+	})
+}
+
+func (lambda *Lambda) partition(predicate func(runtime.Object) bool) (matched, unmatched *Lambda) {
+	matched, matchedCh := lambda.clone()
+	unmatched, unmatchedCh := lambda.clone()
+	emit := func(l *Lambda, ch chan runtime.Object, items []runtime.Object) {
+		defer close(ch)
+		for _, item := range items {
+			if !l.send(ch, item) {
+				return
+			}
+		}
+	}
+	go func() {
+		var matchedItems, unmatchedItems []runtime.Object
+		lambda.forEach(func(item runtime.Object) bool {
+			if predicate(item) {
+				matchedItems = append(matchedItems, item)
+			} else {
+				unmatchedItems = append(unmatchedItems, item)
+			}
+			return true
+		})
+		go emit(matched, matchedCh, matchedItems)
+		go emit(unmatched, unmatchedCh, unmatchedItems)
+	}()
+	return
+}
+
 //********************************************************
 // Kubernetes Operation
 //********************************************************
 
-// List lists all items indexed in the local cache
+// ListWithLabelSelector lists items matching the label selector in the local cache, or from
+// apiserver if the lambda is live
 func (lambda *Lambda) ListWithLabelSelector(selector labels.Selector) *Lambda {
 	var wg sync.WaitGroup
 	ch := make(chan runtime.Object)
@@ -85,23 +224,40 @@ func (lambda *Lambda) ListWithLabelSelector(selector labels.Selector) *Lambda {
 			namespace := namespace
 			wg.Add(1)
 			go func() {
-				objs, err := lambda.listFunc(namespace, selector)
+				defer wg.Done()
+				err := lambda.listFunc(namespace, selector, func(obj runtime.Object) bool {
+					return lambda.send(ch, obj)
+				})
 				if err != nil {
-					panic(err)
-				}
-				for _, obj := range objs {
-					ch <- obj
+					lambda.addError(&ObjectError{
+						Resource:  lambda.rs,
+						Namespace: namespace,
+						Verb:      VerbList,
+						Err:       err,
+					})
 				}
-				wg.Done()
 			}()
 		}
 		wg.Wait()
 		close(ch)
 	}()
+	drain(lambda.val)
 	lambda.val = ch
 	return lambda
 }
 
+// ListWithSelector lists items matching the label selector string, e.g. "app in (web,api),!canary".
+// Nothing is listed if the selector fails to be parsed.
+func (lambda *Lambda) ListWithSelector(selector string) *Lambda {
+	s, err := labels.Parse(selector)
+	if err != nil {
+		lambda.addError(err)
+		s = labels.Nothing()
+	}
+	return lambda.ListWithLabelSelector(s)
+}
+
+// List lists all items indexed in the local cache
 func (lambda *Lambda) List() *Lambda {
 	return lambda.ListWithLabelSelector(labels.Everything())
 }
@@ -111,14 +267,14 @@ func (lambda *Lambda) List() *Lambda {
 // Fails if any element already exists
 func (lambda *Lambda) Create() (created bool, err error) {
 	err = lambda.run(func() {
-		for item := range lambda.val {
+		lambda.forEach(func(item runtime.Object) bool {
 			if err := lambda.createFunc(item); err != nil {
-				lambda.addError(err)
-				continue
+				lambda.addObjectError(VerbCreate, item, err)
 			} else {
 				created = true
 			}
-		}
+			return true
+		})
 	})
 	return
 }
@@ -128,15 +284,15 @@ func (lambda *Lambda) Create() (created bool, err error) {
 func (lambda *Lambda) CreateIfNotExist() (created, existed bool, err error) {
 	err = lambda.run(
 		func() {
-			for item := range lambda.val {
+			lambda.forEach(func(item runtime.Object) bool {
 				accessor, err := meta.Accessor(item)
 				if err != nil {
 					lambda.addError(err)
-					continue
+					return true
 				}
 				if _, err := lambda.getFunc(accessor.GetNamespace(), accessor.GetName()); err != nil {
 					if err := lambda.createFunc(item); err != nil {
-						lambda.addError(err)
+						lambda.addObjectError(VerbCreate, item, err)
 					} else {
 						created = true
 					}
@@ -144,41 +300,93 @@ func (lambda *Lambda) CreateIfNotExist() (created, existed bool, err error) {
 					existed = true
 					created = true
 				}
-			}
+				return true
+			})
 		},
 	)
 	return
 }
 
-// Delete remove every element in the lambda collection
+// Delete remove every element in the lambda collection, with the UID precondition as DeleteWith
 func (lambda *Lambda) Delete() (deleted bool, err error) {
+	return lambda.DeleteWith(nil)
+}
+
+// DeleteWith removes every element with the delete options. The UID of element is set as
+// precondition if absent from the options, so that a recreated object of the same name
+// won't be deleted by accident. Note that the preconditions of the vendored apimachinery
+// only support UID, so resourceVersion is not checked.
+func (lambda *Lambda) DeleteWith(opts *metav1.DeleteOptions) (deleted bool, err error) {
+	return lambda.deleteWith(func(item runtime.Object) *metav1.DeleteOptions {
+		return deleteOptionsFor(opts, item)
+	})
+}
+
+// DeleteForeground removes every element after its dependents are deleted
+func (lambda *Lambda) DeleteForeground() (deleted bool, err error) {
+	policy := metav1.DeletePropagationForeground
+	return lambda.DeleteWith(&metav1.DeleteOptions{PropagationPolicy: &policy})
+}
+
+// DeleteOrphan removes every element and orphans its dependents
+func (lambda *Lambda) DeleteOrphan() (deleted bool, err error) {
+	policy := metav1.DeletePropagationOrphan
+	return lambda.DeleteWith(&metav1.DeleteOptions{PropagationPolicy: &policy})
+}
+
+// DeleteWithGracePeriod removes every element with the grace period in seconds
+func (lambda *Lambda) DeleteWithGracePeriod(seconds int64) (deleted bool, err error) {
+	return lambda.DeleteWith(&metav1.DeleteOptions{GracePeriodSeconds: &seconds})
+}
+
+// deleteOptionsFor copies the delete options with UID precondition of the object
+func deleteOptionsFor(opts *metav1.DeleteOptions, object runtime.Object) *metav1.DeleteOptions {
+	if opts == nil {
+		opts = &metav1.DeleteOptions{}
+	}
+	opts = opts.DeepCopy()
+	if opts.Preconditions != nil && opts.Preconditions.UID != nil {
+		return opts
+	}
+	accessor, err := meta.Accessor(object)
+	if err != nil || accessor.GetUID() == "" {
+		return opts
+	}
+	uid := accessor.GetUID()
+	opts.Preconditions = &metav1.Preconditions{UID: &uid}
+	return opts
+}
+
+func (lambda *Lambda) deleteWith(optsFor func(runtime.Object) *metav1.DeleteOptions) (deleted bool, err error) {
 	err = lambda.run(
 		func() {
-			for item := range lambda.val {
-				if err := lambda.deleteFunc(item); err != nil {
-					lambda.addError(err)
+			lambda.forEach(func(item runtime.Object) bool {
+				if err := lambda.deleteFunc(item, optsFor(item)); err != nil {
+					lambda.addObjectError(VerbDelete, item, err)
 				} else {
 					deleted = true
 				}
-			}
+				return true
+			})
 		},
 	)
 	return
 }
 
-// DeleteIfExist delete elements in the lambda collection if it exists
+// DeleteIfExist delete elements in the lambda collection if it exists, with the UID
+// precondition as DeleteWith
 func (lambda *Lambda) DeleteIfExist() (deleted, existed bool, err error) {
 	err = lambda.run(
 		func() {
-			for item := range lambda.val {
+			lambda.forEach(func(item runtime.Object) bool {
 				accessor, err := meta.Accessor(item)
 				if err != nil {
 					lambda.addError(err)
-					continue
+					return true
 				}
 				if _, err := lambda.getFunc(accessor.GetNamespace(), accessor.GetName()); err == nil {
-					if err := lambda.deleteFunc(item); err != nil {
-						lambda.addError(err)
+					if err := lambda.deleteFunc(item, deleteOptionsFor(nil, item)); err != nil {
+						lambda.addObjectError(VerbDelete, item, err)
 					} else {
 						deleted = true
 						existed = true
@@ -186,7 +394,8 @@ func (lambda *Lambda) DeleteIfExist() (deleted, existed bool, err error) {
 				} else {
 					deleted = true
 				}
-			}
+				return true
+			})
 		},
 	)
 	return
@@ -196,13 +405,14 @@ func (lambda *Lambda) DeleteIfExist() (deleted, existed bool, err error) {
 func (lambda *Lambda) Update() (updated bool, err error) {
 	err = lambda.run(
 		func() {
-			for item := range lambda.val {
+			lambda.forEach(func(item runtime.Object) bool {
 				if err := lambda.updateFunc(item); err != nil {
-					lambda.addError(err)
+					lambda.addObjectError(VerbUpdate, item, err)
 				} else {
 					updated = true
 				}
-			}
+				return true
+			})
 		},
 	)
 	return
@@ -212,51 +422,174 @@ func (lambda *Lambda) Update() (updated bool, err error) {
 func (lambda *Lambda) UpdateIfExist() (updated, existed bool, err error) {
 	err = lambda.run(
 		func() {
-			for item := range lambda.val {
+			lambda.forEach(func(item runtime.Object) bool {
 				accessor, err := meta.Accessor(item)
 				if err != nil {
 					lambda.addError(err)
-					continue
+					return true
 				}
 				if _, err := lambda.getFunc(accessor.GetNamespace(), accessor.GetName()); err == nil {
 					if err := lambda.updateFunc(item); err != nil {
-						lambda.addError(err)
+						lambda.addObjectError(VerbUpdate, item, err)
 					} else {
 						updated = true
 						existed = true
 					}
 				} else {
+					lambda.addObjectError(VerbGet, item, err)
+				}
+				return true
+			})
+		},
+	)
+	return
+}
+
+// RetryResult reports how many attempts it takes to update an object
+type RetryResult struct {
+	Namespace string
+	Name      string
+	Attempts  int
+	Updated   bool
+}
+
+// UpdateWithRetry applies the mutator to a copy of every element and updates it. Upon conflict,
+// the latest object is read from apiserver and mutated again, retrying with the backoff.
+// See k8s.io/client-go/util/retry for the recommended backoff.
+func (lambda *Lambda) UpdateWithRetry(mutator Consumer, backoff wait.Backoff) (results []RetryResult, err error) {
+	err = lambda.run(
+		func() {
+			lambda.forEach(func(item runtime.Object) bool {
+				accessor, err := meta.Accessor(item)
+				if err != nil {
 					lambda.addError(err)
+					return true
 				}
-			}
+				result := RetryResult{
+					Namespace: accessor.GetNamespace(),
+					Name:      accessor.GetName(),
+				}
+				current := item
+				err = retry.RetryOnConflict(backoff, func() error {
+					if result.Attempts > 0 {
+						latest, err := lambda.liveGetFunc(result.Namespace, result.Name)
+						if err != nil {
+							return err
+						}
+						current = latest
+					}
+					result.Attempts++
+					mutated := callConsumer(mutator, current.DeepCopyObject()).(runtime.Object)
+					return lambda.updateFunc(mutated)
+				})
+				if err != nil {
+					lambda.addObjectError(VerbUpdate, item, err)
+				} else {
+					result.Updated = true
+				}
+				results = append(results, result)
+				return true
+			})
 		},
 	)
 	return
 }
 
+// UpdateOrCreate updates the element if it exists or creates it
 func (lambda *Lambda) UpdateOrCreate() (updated, created bool, err error) {
 	err = lambda.run(
 		func() {
-			for item := range lambda.val {
+			lambda.forEach(func(item runtime.Object) bool {
 				accessor, err := meta.Accessor(item)
 				if err != nil {
 					lambda.addError(err)
-					continue
+					return true
 				}
 				if _, err := lambda.getFunc(accessor.GetNamespace(), accessor.GetName()); err == nil {
 					if err := lambda.updateFunc(item); err != nil {
-						lambda.addError(err)
+						lambda.addObjectError(VerbUpdate, item, err)
 					} else {
 						updated = true
 					}
 				} else {
 					if err := lambda.createFunc(item); err != nil {
-						lambda.addError(err)
+						lambda.addObjectError(VerbCreate, item, err)
 					} else {
 						created = true
 					}
 				}
-			}
+				return true
+			})
+		},
+	)
+	return
+}
+
+// Patch patches every element with the data of the patch type
+func (lambda *Lambda) Patch(patchType types.PatchType, data []byte) (patched bool, err error) {
+	err = lambda.run(
+		func() {
+			lambda.forEach(func(item runtime.Object) bool {
+				if err := lambda.patchFunc(item, patchType, data); err != nil {
+					lambda.addObjectError(VerbPatch, item, err)
+				} else {
+					patched = true
+				}
+				return true
+			})
+		},
+	)
+	return
+}
+
+// PatchMap applies the consumer to a copy of every element and patches only the difference
+// between them, so that the fields untouched won't conflict with other writers.
+// Elements left unchanged by the consumer are skipped.
+func (lambda *Lambda) PatchMap(consumer Consumer) (patched bool, err error) {
+	err = lambda.run(
+		func() {
+			lambda.forEach(func(item runtime.Object) bool {
+				modified := callConsumer(consumer, item.DeepCopyObject()).(runtime.Object)
+				patchType, data, err := createPatch(item, modified)
+				if err != nil {
+					lambda.addObjectError(VerbPatch, item, err)
+					return true
+				}
+				if isEmptyPatch(data) {
+					return true
+				}
+				if err := lambda.patchFunc(item, patchType, data); err != nil {
+					lambda.addObjectError(VerbPatch, item, err)
+				} else {
+					patched = true
+				}
+				return true
+			})
+		},
+	)
+	return
+}
+
+// Apply declares every element with server-side apply as the field manager. Fields owned by
+// other managers are overwritten if force is true, otherwise they are reported as conflicts.
+func (lambda *Lambda) Apply(fieldManager string, force bool) (results []ApplyResult, err error) {
+	err = lambda.run(
+		func() {
+			lambda.forEach(func(item runtime.Object) bool {
+				result := ApplyResult{}
+				if accessor, err := meta.Accessor(item); err == nil {
+					result.Namespace = accessor.GetNamespace()
+					result.Name = accessor.GetName()
+				}
+				if err := lambda.applyFunc(item, fieldManager, force); err != nil {
+					result.Conflicts = applyConflicts(err)
+					lambda.addObjectError(VerbApply, item, err)
+				} else {
+					result.Applied = true
+				}
+				results = append(results, result)
+				return true
+			})
 		},
 	)
 	return
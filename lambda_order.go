@@ -0,0 +1,145 @@
+package lambda
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// buffer collects every element from upstream lambda, and then passes the
+// elements returned by f to the next lambda
+func (lambda *Lambda) buffer(f func([]runtime.Object) []runtime.Object) *Lambda {
+	l, ch := lambda.clone()
+	go func() {
+		defer close(ch)
+		var items []runtime.Object
+		lambda.forEach(func(item runtime.Object) bool {
+			items = append(items, item)
+			return true
+		})
+		if lambda.ctx.Err() != nil {
+			return
+		}
+		for _, item := range f(items) {
+			if !l.send(ch, item) {
+				return
+			}
+		}
+	}()
+	return l
+}
+
+func (lambda *Lambda) sortBy(less func(a, b runtime.Object) bool) *Lambda {
+	return lambda.buffer(func(items []runtime.Object) []runtime.Object {
+		sort.SliceStable(items, func(i, j int) bool {
+			return less(items[i], items[j])
+		})
+		return items
+	})
+}
+
+func lessByName(a, b runtime.Object) bool {
+	accessorA, errA := meta.Accessor(a)
+	accessorB, errB := meta.Accessor(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	if accessorA.GetNamespace() != accessorB.GetNamespace() {
+		return accessorA.GetNamespace() < accessorB.GetNamespace()
+	}
+	return accessorA.GetName() < accessorB.GetName()
+}
+
+func lessByCreationTimestamp(a, b runtime.Object) bool {
+	accessorA, errA := meta.Accessor(a)
+	accessorB, errB := meta.Accessor(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return accessorA.GetCreationTimestamp().Time.Before(accessorB.GetCreationTimestamp().Time)
+}
+
+//********************************************************
+// Lambda using Comparator
+//********************************************************
+
+// SortBy sorts the elements with the comparator. Elements are kept in their
+// original order if the comparator considers them equal.
+func (lambda *Lambda) SortBy(less Comparator) *Lambda {
+	return lambda.sortBy(func(a, b runtime.Object) bool {
+		return callComparator(less, a, b)
+	})
+}
+
+// TopN takes the first n elements ordered by the comparator
+func (lambda *Lambda) TopN(n int, less Comparator) *Lambda {
+	return lambda.SortBy(less).Limit(n)
+}
+
+//********************************************************
+// Ordering Lambda with no parameter
+//********************************************************
+
+// SortByName sorts the elements by namespace and name
+func (lambda *Lambda) SortByName() *Lambda {
+	return lambda.sortBy(lessByName)
+}
+
+// SortByCreationTimestamp sorts the elements from the oldest created to the latest
+func (lambda *Lambda) SortByCreationTimestamp() *Lambda {
+	return lambda.sortBy(lessByCreationTimestamp)
+}
+
+// Reverse reverses the order of the elements
+func (lambda *Lambda) Reverse() *Lambda {
+	return lambda.buffer(func(items []runtime.Object) []runtime.Object {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+		return items
+	})
+}
+
+// OldestCreated filters out the oldest created object
+func (lambda *Lambda) OldestCreated() *Lambda {
+	return lambda.SortByCreationTimestamp().Limit(1)
+}
+
+// Limit takes at most n elements and drops the rest
+func (lambda *Lambda) Limit(n int) *Lambda {
+	l, ch := lambda.clone()
+	go func() {
+		defer close(ch)
+		if n <= 0 {
+			drain(lambda.val)
+			return
+		}
+		count := 0
+		lambda.forEach(func(item runtime.Object) bool {
+			if !l.send(ch, item) {
+				return false
+			}
+			count++
+			return count < n
+		})
+	}()
+	return l
+}
+
+// Skip drops the first n elements and passes the rest
+func (lambda *Lambda) Skip(n int) *Lambda {
+	l, ch := lambda.clone()
+	go func() {
+		defer close(ch)
+		count := 0
+		lambda.forEach(func(item runtime.Object) bool {
+			if count < n {
+				count++
+				return true
+			}
+			return l.send(ch, item)
+		})
+	}()
+	return l
+}
@@ -0,0 +1,119 @@
+package lambda
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// switchType creates a lambda of another resource in the same namespaces,
+// carrying over the context, error chain and dry-run plan of the lambda
+func (lambda *Lambda) switchType(rs Resource) (*Lambda, chan runtime.Object, error) {
+	if lambda.kcl == nil {
+		return nil, nil, fmt.Errorf("no kubernetes client bound to lambda of %s", lambda.rs.Name)
+	}
+	exec, err := lambda.kcl.TypeE(rs)
+	if err != nil {
+		return nil, nil, err
+	}
+	l, ch := exec.InNamespaceContext(lambda.ctx, lambda.namespaces...).clone()
+	l.errs = lambda.errs
+	if lambda.plan != nil {
+		l = l.DryRun()
+		l.plan = lambda.plan
+	}
+	return l, ch, nil
+}
+
+// OwnedBy filters out the elements not owned by any element of the owner lambda
+func (lambda *Lambda) OwnedBy(owner *Lambda) *Lambda {
+	l, ch := lambda.clone()
+	go func() {
+		defer close(ch)
+		uids := make(map[types.UID]bool)
+		owner.forEach(func(item runtime.Object) bool {
+			accessor, err := meta.Accessor(item)
+			if err != nil {
+				l.addError(err)
+				return true
+			}
+			uids[accessor.GetUID()] = true
+			return true
+		})
+		lambda.forEach(func(item runtime.Object) bool {
+			accessor, err := meta.Accessor(item)
+			if err != nil {
+				l.addError(err)
+				return true
+			}
+			for _, ref := range accessor.GetOwnerReferences() {
+				if uids[ref.UID] {
+					return l.send(ch, item)
+				}
+			}
+			return true
+		})
+	}()
+	return l
+}
+
+// Owners transforms the elements to their owners of the resource type.
+// Owners are fetched from the local cache and every owner appears only once.
+func (lambda *Lambda) Owners(rs Resource) *Lambda {
+	l, ch, err := lambda.switchType(rs)
+	if err != nil {
+		lambda.addError(err)
+		return lambda.Dummy()
+	}
+	kind := rs.GetKind()
+	namespaced := GetResouceIndexerInstance().IsNamespaced(rs)
+	go func() {
+		defer close(ch)
+		seen := make(map[types.UID]bool)
+		lambda.forEach(func(item runtime.Object) bool {
+			accessor, err := meta.Accessor(item)
+			if err != nil {
+				l.addError(err)
+				return true
+			}
+			for _, ref := range accessor.GetOwnerReferences() {
+				if ref.Kind != kind || seen[ref.UID] {
+					continue
+				}
+				namespace := ""
+				if namespaced {
+					namespace = accessor.GetNamespace()
+				}
+				owner, err := l.getFunc(namespace, ref.Name)
+				if err != nil {
+					// owner has gone
+					continue
+				}
+				ownerAccessor, err := meta.Accessor(owner)
+				if err != nil || ownerAccessor.GetUID() != ref.UID {
+					continue
+				}
+				seen[ref.UID] = true
+				if !l.send(ch, owner) {
+					return false
+				}
+			}
+			return true
+		})
+	}()
+	return l
+}
+
+// Children lists the resources of the type owned by any element
+// in the namespaces of the lambda.
+func (lambda *Lambda) Children(rs Resource) *Lambda {
+	l, ch, err := lambda.switchType(rs)
+	if err != nil {
+		lambda.addError(err)
+		return lambda.Dummy()
+	}
+	close(ch)
+	return l.List().OwnedBy(lambda)
+}
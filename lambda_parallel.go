@@ -0,0 +1,133 @@
+package lambda
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ParallelOption configures a parallel lambda stage
+type ParallelOption func(*parallelConfig)
+
+type parallelConfig struct {
+	preserveOrder bool
+}
+
+// PreserveOrder makes the parallel stage emit elements in the same order as
+// they are received. Elements finished early are buffered until its
+// predecessors are done.
+func PreserveOrder() ParallelOption {
+	return func(config *parallelConfig) {
+		config.preserveOrder = true
+	}
+}
+
+type indexedObject struct {
+	index int
+	obj   runtime.Object
+	keep  bool
+}
+
+// parallel fans out the elements to a pool of workers applying f, and passes
+// the object returned to the next lambda if f also returns true. A pool of
+// less than one worker runs a single one.
+func (lambda *Lambda) parallel(workers int, opts []ParallelOption, f func(runtime.Object) (runtime.Object, bool)) *Lambda {
+	config := &parallelConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	l, ch := lambda.clone()
+	in := make(chan indexedObject)
+	out := make(chan indexedObject)
+
+	go func() {
+		defer close(in)
+		index := 0
+		lambda.forEach(func(item runtime.Object) bool {
+			select {
+			case <-lambda.ctx.Done():
+				return false
+			case in <- indexedObject{index: index, obj: item}:
+				index++
+				return true
+			}
+		})
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range in {
+				obj, keep := f(task.obj)
+				select {
+				case <-lambda.ctx.Done():
+					return
+				case out <- indexedObject{index: task.index, obj: obj, keep: keep}:
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	go func() {
+		defer close(ch)
+		stopped := false
+		emit := func(result indexedObject) {
+			if !stopped && result.keep && result.obj != nil {
+				stopped = !l.send(ch, result.obj)
+			}
+		}
+		pending := map[int]indexedObject{}
+		next := 0
+		for result := range out {
+			if !config.preserveOrder {
+				emit(result)
+				continue
+			}
+			pending[result.index] = result
+			for {
+				result, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+				emit(result)
+			}
+		}
+	}()
+	return l
+}
+
+// MapParallel is the concurrent version of Map which applies the consumer
+// with at most the number of workers at the same time
+func (lambda *Lambda) MapParallel(workers int, consumer Consumer, opts ...ParallelOption) *Lambda {
+	return lambda.parallel(workers, opts, func(item runtime.Object) (runtime.Object, bool) {
+		return callConsumer(consumer, item).(runtime.Object), true
+	})
+}
+
+// IterParallel is the concurrent version of Iter which applies the function
+// with at most the number of workers at the same time
+func (lambda *Lambda) IterParallel(workers int, function Function, opts ...ParallelOption) *Lambda {
+	return lambda.parallel(workers, opts, func(item runtime.Object) (runtime.Object, bool) {
+		callFunction(function, item)
+		return item, true
+	})
+}
+
+// GrepParallel is the concurrent version of Grep which tests the predicate
+// with at most the number of workers at the same time
+func (lambda *Lambda) GrepParallel(workers int, predicate Predicate, opts ...ParallelOption) *Lambda {
+	return lambda.parallel(workers, opts, func(item runtime.Object) (runtime.Object, bool) {
+		return item, callPredicate(predicate, item)
+	})
+}
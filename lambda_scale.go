@@ -0,0 +1,65 @@
+package lambda
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+// scaleAPIResource returns the api resource of the scale subresource
+func scaleAPIResource(rs Resource) *metav1.APIResource {
+	api := subresourceAPIResource(rs, SubresourceScale)
+	api.Kind = "Scale"
+	return api
+}
+
+// getReplicas reads spec.replicas which defaults to 1 if absent
+func getReplicas(u *unstructured.Unstructured) int32 {
+	replicas, found, err := unstructured.NestedInt64(u.Object, "spec", "replicas")
+	if err != nil || !found {
+		return 1
+	}
+	return int32(replicas)
+}
+
+// scaleWithDynamicClient reads the scale subresource of the object and updates its replicas
+func scaleWithDynamicClient(client dynamic.ResourceInterface, name string, replicas func(current int32) int32) error {
+	scale, err := client.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	desired := replicas(getReplicas(scale))
+	if err := unstructured.SetNestedField(scale.Object, int64(desired), "spec", "replicas"); err != nil {
+		return err
+	}
+	_, err = client.Update(scale)
+	return err
+}
+
+// Scale sets the replicas of every element through the scale subresource. Only Deployment,
+// ReplicaSet, StatefulSet and ReplicationController are scalable.
+func (lambda *Lambda) Scale(replicas int32) (scaled bool, err error) {
+	return lambda.ScaleBy(func(int32) int32 {
+		return replicas
+	})
+}
+
+// ScaleBy sets the replicas of every element to the value returned by the function,
+// which receives the current replicas read from the scale subresource.
+func (lambda *Lambda) ScaleBy(replicas func(current int32) int32) (scaled bool, err error) {
+	lambda.checkSubresource(SubresourceScale)
+	err = lambda.run(
+		func() {
+			lambda.forEach(func(item runtime.Object) bool {
+				if err := lambda.scaleFunc(item, replicas); err != nil {
+					lambda.addObjectError(VerbScale, item, err)
+				} else {
+					scaled = true
+				}
+				return true
+			})
+		},
+	)
+	return
+}
@@ -0,0 +1,142 @@
+package lambda
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// uidKey identifies an object by its UID, falling back to namespace/name for
+// the object not yet persisted, e.g. the ones from Add.
+func uidKey(object runtime.Object) string {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return ""
+	}
+	if uid := accessor.GetUID(); uid != "" {
+		return string(uid)
+	}
+	return accessor.GetNamespace() + "/" + accessor.GetName()
+}
+
+// namespacedNameKey identifies an object by namespace/name regardless of its UID, so that
+// the same objects listed from different clusters match.
+func namespacedNameKey(object runtime.Object) string {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return ""
+	}
+	return accessor.GetNamespace() + "/" + accessor.GetName()
+}
+
+// mergeErrors copies errors of the other lambda if it's from another pipeline
+func (lambda *Lambda) mergeErrors(other *Lambda) {
+	if lambda.errs == other.errs {
+		return
+	}
+	for _, err := range other.Errors() {
+		lambda.addError(err)
+	}
+}
+
+func (lambda *Lambda) checkResource(other *Lambda) {
+	if lambda.rs != other.rs {
+		lambda.addError(fmt.Errorf("mismatched resource %s and %s", lambda.rs.Name, other.rs.Name))
+	}
+}
+
+// keys consumes the lambda and returns the keys of its elements
+func (lambda *Lambda) keys(keyFunction func(runtime.Object) string) map[string]bool {
+	keys := make(map[string]bool)
+	lambda.forEach(func(item runtime.Object) bool {
+		keys[keyFunction(item)] = true
+		return true
+	})
+	return keys
+}
+
+func (lambda *Lambda) distinct(keyFunction func(runtime.Object) string) *Lambda {
+	seen := make(map[string]bool)
+	return lambda.grep(func(item runtime.Object) bool {
+		key := keyFunction(item)
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+		return true
+	})
+}
+
+func (lambda *Lambda) filterByKeys(other *Lambda, keyFunction func(runtime.Object) string, keep bool) *Lambda {
+	lambda.checkResource(other)
+	l, ch := lambda.clone()
+	go func() {
+		defer close(ch)
+		keys := other.keys(keyFunction)
+		l.mergeErrors(other)
+		lambda.forEach(func(item runtime.Object) bool {
+			if keys[keyFunction(item)] == keep {
+				return l.send(ch, item)
+			}
+			return true
+		})
+	}()
+	return l
+}
+
+// Distinct removes duplicated elements keyed by UID, or namespace/name if UID is absent
+func (lambda *Lambda) Distinct() *Lambda {
+	return lambda.distinct(uidKey)
+}
+
+// Union appends elements from the other lambda of the same resource and removes duplicated ones
+func (lambda *Lambda) Union(other *Lambda) *Lambda {
+	lambda.checkResource(other)
+	l, ch := lambda.clone()
+	go func() {
+		defer close(ch)
+		ok := true
+		lambda.forEach(func(item runtime.Object) bool {
+			ok = l.send(ch, item)
+			return ok
+		})
+		if !ok {
+			drain(other.val)
+			return
+		}
+		other.forEach(func(item runtime.Object) bool {
+			return l.send(ch, item)
+		})
+		l.mergeErrors(other)
+	}()
+	return l.Distinct()
+}
+
+// Intersect keeps the elements also present in the other lambda, compared by namespace/name.
+// Objects of different namespaces never match, use IntersectBy keyed by the name instead,
+// e.g. the ConfigMaps in staging also present in prod.
+func (lambda *Lambda) Intersect(other *Lambda) *Lambda {
+	return lambda.filterByKeys(other, namespacedNameKey, true)
+}
+
+// IntersectBy keeps the elements also present in the other lambda, compared by the key function
+func (lambda *Lambda) IntersectBy(other *Lambda, keyFunction KeyFunction) *Lambda {
+	return lambda.filterByKeys(other, func(item runtime.Object) string {
+		return callKeyFunction(keyFunction, item)
+	}, true)
+}
+
+// Except removes the elements present in the other lambda, compared by namespace/name.
+// Objects of different namespaces never match, use ExceptBy keyed by the name instead,
+// e.g. the ConfigMaps in staging missing from prod.
+func (lambda *Lambda) Except(other *Lambda) *Lambda {
+	return lambda.filterByKeys(other, namespacedNameKey, false)
+}
+
+// ExceptBy removes the elements present in the other lambda, compared by the key function
+func (lambda *Lambda) ExceptBy(other *Lambda, keyFunction KeyFunction) *Lambda {
+	return lambda.filterByKeys(other, func(item runtime.Object) string {
+		return callKeyFunction(keyFunction, item)
+	}, false)
+}
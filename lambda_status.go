@@ -0,0 +1,62 @@
+package lambda
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// checkSubresource records an error if the discovery of the client tells the subresource is
+// not served. Clients not implementing SubresourceIndexer leave it to apiserver.
+func (lambda *Lambda) checkSubresource(subresource string) {
+	indexer, ok := lambda.kcl.(SubresourceIndexer)
+	if !ok {
+		return
+	}
+	served, err := indexer.HasSubresource(lambda.rs, subresource)
+	if err != nil {
+		lambda.addError(fmt.Errorf("failed to discover subresources of %s: %v", lambda.rs.Name, err))
+		return
+	}
+	if !served {
+		lambda.addError(fmt.Errorf("resource %s has no %s subresource", lambda.rs.Name, subresource))
+	}
+}
+
+// UpdateStatus updates the status of every element through the status subresource.
+// Changes to fields other than status are ignored by the apiserver.
+func (lambda *Lambda) UpdateStatus() (updated bool, err error) {
+	lambda.checkSubresource(SubresourceStatus)
+	err = lambda.run(
+		func() {
+			lambda.forEach(func(item runtime.Object) bool {
+				if err := lambda.updateStatusFunc(item); err != nil {
+					lambda.addObjectError(VerbUpdateStatus, item, err)
+				} else {
+					updated = true
+				}
+				return true
+			})
+		},
+	)
+	return
+}
+
+// PatchStatus patches the status subresource of every element with the data of the patch type
+func (lambda *Lambda) PatchStatus(patchType types.PatchType, data []byte) (patched bool, err error) {
+	lambda.checkSubresource(SubresourceStatus)
+	err = lambda.run(
+		func() {
+			lambda.forEach(func(item runtime.Object) bool {
+				if err := lambda.patchStatusFunc(item, patchType, data); err != nil {
+					lambda.addObjectError(VerbPatchStatus, item, err)
+				} else {
+					patched = true
+				}
+				return true
+			})
+		},
+	)
+	return
+}
@@ -1,12 +1,25 @@
 package lambda
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/retry"
 )
 
 func TestLatestObject(t *testing.T) {
@@ -17,7 +30,7 @@ func TestLatestObject(t *testing.T) {
 			cm := &corev1.ConfigMap{}
 			cm.Name = "testcm1"
 			cm.Namespace = "foons"
-			cm.CreationTimestamp = metav1.Time{time.Now()}
+			cm.CreationTimestamp = metav1.Time{Time: time.Now()}
 			return cm
 		}).
 		Add(func() *corev1.ConfigMap {
@@ -25,7 +38,7 @@ func TestLatestObject(t *testing.T) {
 			cm.Name = "testcm2"
 			cm.Namespace = "foons"
 			time.Sleep(time.Second)
-			cm.CreationTimestamp = metav1.Time{time.Now()}
+			cm.CreationTimestamp = metav1.Time{Time: time.Now()}
 			return cm
 		}).Create()
 	assert.NoError(t, err, "creation failed")
@@ -36,3 +49,843 @@ func TestLatestObject(t *testing.T) {
 		Element()
 	assert.Equal(t, "testcm2", cm2.(*corev1.ConfigMap).Name, "configmap name wrong")
 }
+
+func TestCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	created, err := Mock().Type(ConfigMap).
+		InNamespaceContext(ctx, "foons").
+		Add(func() *corev1.ConfigMap {
+			cm := &corev1.ConfigMap{}
+			cm.Name = "testcm1"
+			cm.Namespace = "foons"
+			return cm
+		}).Create()
+	assert.Equal(t, context.Canceled, err, "context error not returned")
+	assert.False(t, created, "created after cancellation")
+}
+
+func TestFirstStopsUpstream(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	mock := Mock()
+	lambda := mock.Type(ConfigMap).InNamespace("foons")
+	for i := 0; i < 5; i++ {
+		i := i
+		lambda = lambda.Add(func() *corev1.ConfigMap {
+			cm := &corev1.ConfigMap{}
+			cm.Name = fmt.Sprintf("testcm%d", i)
+			cm.Namespace = "foons"
+			return cm
+		})
+	}
+	cm, err := lambda.WithContext(ctx).
+		First(func(cm *corev1.ConfigMap) bool {
+			return true
+		}).
+		Element()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, "testcm0", cm.(*corev1.ConfigMap).Name, "configmap name wrong")
+}
+
+func TestMapParallelPreserveOrder(t *testing.T) {
+	lambda := Mock().Type(ConfigMap).InNamespace("foons")
+	for i := 0; i < 20; i++ {
+		i := i
+		lambda = lambda.Add(func() *corev1.ConfigMap {
+			cm := &corev1.ConfigMap{}
+			cm.Name = fmt.Sprintf("testcm%d", i)
+			cm.Namespace = "foons"
+			return cm
+		})
+	}
+	cms, err := lambda.
+		MapParallel(4, func(cm *corev1.ConfigMap) *corev1.ConfigMap {
+			time.Sleep(time.Duration(20-len(cm.Name)) * time.Millisecond)
+			cm.Labels = map[string]string{"mapped": "true"}
+			return cm
+		}, PreserveOrder()).
+		GrepParallel(4, func(cm *corev1.ConfigMap) bool {
+			return cm.Name != "testcm3"
+		}, PreserveOrder()).
+		Elements()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 19, len(cms), "configmap count wrong")
+	for i, cm := range cms {
+		idx := i
+		if i >= 3 {
+			idx++
+		}
+		assert.Equal(t, fmt.Sprintf("testcm%d", idx), cm.(*corev1.ConfigMap).Name, "order not preserved")
+		assert.Equal(t, "true", cm.(*corev1.ConfigMap).Labels["mapped"], "configmap not mapped")
+	}
+}
+
+func TestParallelWorkerBound(t *testing.T) {
+	from := func() *Lambda {
+		lambda := Mock().Type(ConfigMap).InNamespace("foons")
+		for i := 0; i < 12; i++ {
+			i := i
+			lambda = lambda.Add(func() *corev1.ConfigMap {
+				cm := &corev1.ConfigMap{}
+				cm.Name = fmt.Sprintf("testcm%d", i)
+				cm.Namespace = "foons"
+				return cm
+			})
+		}
+		return lambda
+	}
+	// track counts the consumers running at the same time and records the max
+	track := func(running, max *int32) {
+		n := atomic.AddInt32(running, 1)
+		defer atomic.AddInt32(running, -1)
+		for {
+			m := atomic.LoadInt32(max)
+			if n <= m || atomic.CompareAndSwapInt32(max, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, workers := range []int{-1, 0, 1, 3} {
+		bound := int32(workers)
+		if bound < 1 {
+			bound = 1
+		}
+		var running, max, calls int32
+		count, err := from().MapParallel(workers, func(cm *corev1.ConfigMap) *corev1.ConfigMap {
+			atomic.AddInt32(&calls, 1)
+			track(&running, &max)
+			return cm
+		}).Count()
+		assert.NoError(t, err, "workers %d: some error", workers)
+		assert.Equal(t, 12, count, "workers %d: configmap count wrong", workers)
+		assert.Equal(t, int32(12), calls, "workers %d: map calls wrong", workers)
+		assert.True(t, max <= bound, "workers %d: %d consumers run at the same time", workers, max)
+
+		running, max, calls = 0, 0, 0
+		count, err = from().IterParallel(workers, func(cm *corev1.ConfigMap) {
+			atomic.AddInt32(&calls, 1)
+			track(&running, &max)
+		}).Count()
+		assert.NoError(t, err, "workers %d: some error", workers)
+		assert.Equal(t, 12, count, "workers %d: elements not passed through", workers)
+		assert.Equal(t, int32(12), calls, "workers %d: iter calls wrong", workers)
+		assert.True(t, max <= bound, "workers %d: %d functions run at the same time", workers, max)
+	}
+}
+
+func TestOrdering(t *testing.T) {
+	now := time.Now()
+	from := func() *Lambda {
+		lambda := Mock().Type(ConfigMap).InNamespace("foons")
+		for _, i := range []int{3, 0, 4, 1, 2} {
+			i := i
+			lambda = lambda.Add(func() *corev1.ConfigMap {
+				cm := &corev1.ConfigMap{}
+				cm.Name = fmt.Sprintf("testcm%d", i)
+				cm.Namespace = "foons"
+				cm.CreationTimestamp = metav1.Time{Time: now.Add(time.Duration(i) * time.Minute)}
+				return cm
+			})
+		}
+		return lambda
+	}
+	names := func(lambda *Lambda) []string {
+		var names []string
+		lambda.Each(func(cm *corev1.ConfigMap) {
+			names = append(names, cm.Name)
+		})
+		return names
+	}
+	assert.Equal(t, []string{"testcm1", "testcm0"}, names(from().SortByCreationTimestamp().Reverse().Skip(3)), "all but 3 newest wrong")
+	assert.Equal(t, []string{"testcm0", "testcm1", "testcm2"}, names(from().SortByName().Limit(3)), "sort by name wrong")
+	assert.Equal(t, []string{"testcm4", "testcm3"}, names(from().TopN(2, func(a, b *corev1.ConfigMap) bool {
+		return a.Name > b.Name
+	})), "top n wrong")
+	assert.Equal(t, []string{"testcm0"}, names(from().OldestCreated()), "oldest created wrong")
+}
+
+func TestAggregation(t *testing.T) {
+	from := func() *Lambda {
+		lambda := Mock().Type(ConfigMap).InNamespace()
+		for i := 0; i < 5; i++ {
+			i := i
+			lambda = lambda.Add(func() *corev1.ConfigMap {
+				cm := &corev1.ConfigMap{}
+				cm.Name = fmt.Sprintf("testcm%d", i)
+				cm.Namespace = fmt.Sprintf("foons%d", i%2)
+				cm.Labels = map[string]string{"parity": fmt.Sprintf("%d", i%2)}
+				return cm
+			})
+		}
+		return lambda
+	}
+	count, err := from().Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 5, count, "count wrong")
+
+	groups, err := from().GroupByLabel("parity")
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 3, len(groups["0"]), "label group wrong")
+	assert.Equal(t, 2, len(groups["1"]), "label group wrong")
+
+	groups, err = from().GroupByNamespace()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 3, len(groups["foons0"]), "namespace group wrong")
+
+	groups, err = from().GroupBy(func(cm *corev1.ConfigMap) string {
+		return cm.Name[len(cm.Name)-1:]
+	})
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 5, len(groups), "group wrong")
+
+	names, err := from().Reduce("", func(acc string, cm *corev1.ConfigMap) string {
+		return acc + cm.Name[len(cm.Name)-1:]
+	})
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, "01234", names, "reduce wrong")
+
+	matched, unmatched := from().Partition(func(cm *corev1.ConfigMap) bool {
+		return cm.Namespace == "foons1"
+	})
+	unmatchedCount, err := unmatched.Count()
+	assert.NoError(t, err, "some error")
+	matchedCount, err := matched.Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 2, matchedCount, "partition wrong")
+	assert.Equal(t, 3, unmatchedCount, "partition wrong")
+}
+
+func TestSetOperations(t *testing.T) {
+	mock := Mock()
+	from := func(namespace string, names ...string) *Lambda {
+		lambda := mock.Type(ConfigMap).InNamespace(namespace)
+		for _, name := range names {
+			name := name
+			lambda = lambda.Add(func() *corev1.ConfigMap {
+				cm := &corev1.ConfigMap{}
+				cm.Name = name
+				cm.Namespace = namespace
+				return cm
+			})
+		}
+		return lambda
+	}
+	names := func(lambda *Lambda) []string {
+		var names []string
+		lambda.Each(func(cm *corev1.ConfigMap) {
+			names = append(names, cm.Name)
+		})
+		return names
+	}
+	assert.Equal(t, []string{"a", "b"}, names(from("foons", "a", "b", "a").Distinct()), "distinct wrong")
+	assert.Equal(t, []string{"a", "b", "c"}, names(from("foons", "a", "b").Union(from("foons", "b", "c"))), "union wrong")
+	assert.Equal(t, []string{"b"}, names(from("foons", "a", "b").Intersect(from("foons", "b", "c"))), "intersect wrong")
+	assert.Equal(t, []string{"a"}, names(from("foons", "a", "b").Except(from("foons", "b", "c"))), "except wrong")
+	assert.Nil(t, names(from("staging", "a", "b").Intersect(from("prod", "b", "c"))), "cross-namespace intersect wrong")
+	assert.Equal(t, []string{"a", "b"}, names(from("staging", "a", "b").Except(from("prod", "b", "c"))), "cross-namespace except wrong")
+	byName := func(cm *corev1.ConfigMap) string {
+		return cm.Name
+	}
+	assert.Equal(t, []string{"b"}, names(from("staging", "a", "b").IntersectBy(from("prod", "b", "c"), byName)), "intersect by name wrong")
+	assert.Equal(t, []string{"a"}, names(from("staging", "a", "b").ExceptBy(from("prod", "b", "c"), byName)), "except by name wrong")
+
+	err := from("foons", "a").Except(mock.Type(Secret).InNamespace("foons")).Each(func(cm *corev1.ConfigMap) {})
+	assert.Error(t, err, "mismatched resource not reported")
+
+	cm := func(namespace, name string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+	mock = Mock(cm("staging", "a"), cm("staging", "b"), cm("prod", "b"), cm("prod", "c"))
+	missing, err := mock.Type(ConfigMap).InNamespace("staging").List().
+		ExceptBy(mock.Type(ConfigMap).InNamespace("prod").List(), byName).Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 1, missing, "configmaps missing from prod wrong")
+	shared, err := mock.Type(ConfigMap).InNamespace().List().
+		Intersect(mock.Type(ConfigMap).InNamespace("prod").List()).Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 2, shared, "objects of other namespaces matched by name")
+}
+
+func TestOwnerReferences(t *testing.T) {
+	rc := &corev1.ReplicationController{}
+	rc.Name = "testrc"
+	rc.Namespace = "foons"
+	rc.UID = "rc-uid"
+	pod := func(name string, uid types.UID) *corev1.Pod {
+		pod := &corev1.Pod{}
+		pod.Name = name
+		pod.Namespace = "foons"
+		if uid != "" {
+			pod.OwnerReferences = []metav1.OwnerReference{
+				{Kind: "ReplicationController", Name: "testrc", UID: uid},
+			}
+		}
+		return pod
+	}
+	mock := Mock(rc, pod("owned1", "rc-uid"), pod("owned2", "rc-uid"), pod("orphan", ""), pod("stale", "old-uid"))
+
+	count, err := mock.Type(ReplicationController).InNamespace("foons").List().
+		Children(Pod).
+		Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 2, count, "children count wrong")
+
+	owners, err := mock.Type(Pod).InNamespace("foons").List().
+		Owners(ReplicationController).
+		Elements()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 1, len(owners), "owners count wrong")
+	assert.Equal(t, "testrc", owners[0].(*corev1.ReplicationController).Name, "owner wrong")
+
+	count, err = mock.Type(Pod).InNamespace("foons").List().
+		OwnedBy(mock.Type(ReplicationController).InNamespace("foons").List()).
+		Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 2, count, "owned count wrong")
+}
+
+func TestFieldSnippets(t *testing.T) {
+	pod := func(name, nodeName string, phase corev1.PodPhase) *corev1.Pod {
+		pod := &corev1.Pod{}
+		pod.Name = name
+		pod.Namespace = "foons"
+		pod.Spec.NodeName = nodeName
+		pod.Status.Phase = phase
+		return pod
+	}
+	mock := Mock(
+		pod("pod1", "node-1", corev1.PodRunning),
+		pod("pod2", "node-2", corev1.PodPending),
+		pod("pod3", "", corev1.PodPending),
+	)
+	count := func(lambda *Lambda) int {
+		count, err := lambda.Count()
+		assert.NoError(t, err, "some error")
+		return count
+	}
+	assert.Equal(t, 1, count(mock.Type(Pod).InNamespace("foons").List().FieldEqual("spec.nodeName", "node-1")), "field equal wrong")
+	assert.Equal(t, 2, count(mock.Type(Pod).InNamespace("foons").List().FieldExists("spec.nodeName")), "field exists wrong")
+	assert.Equal(t, 2, count(mock.Type(Pod).InNamespace("foons").List().FieldRegex("spec.nodeName", `^node-\d$`)), "field regex wrong")
+	assert.Equal(t, 2, count(mock.Type(Pod).InNamespace("foons").List().JSONPath(".status.phase", "Pending")), "jsonpath wrong")
+
+	_, err := mock.Type(Pod).InNamespace("foons").List().JSONPath("{.status.phase", "Pending").Count()
+	assert.Error(t, err, "jsonpath parse error not reported")
+}
+
+func TestLabelSelector(t *testing.T) {
+	cm := func(name string, labels map[string]string) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{}
+		cm.Name = name
+		cm.Namespace = "foons"
+		cm.Labels = labels
+		return cm
+	}
+	mock := Mock(
+		cm("web", map[string]string{"app": "web"}),
+		cm("api", map[string]string{"app": "api"}),
+		cm("canary", map[string]string{"app": "web", "canary": "true"}),
+		cm("db", map[string]string{"app": "db"}),
+	)
+	count := func(lambda *Lambda) int {
+		count, err := lambda.Count()
+		assert.NoError(t, err, "some error")
+		return count
+	}
+	assert.Equal(t, 2, count(mock.Type(ConfigMap).InNamespace("foons").ListWithSelector("app in (web,api),!canary")), "list with selector wrong")
+	assert.Equal(t, 2, count(mock.Type(ConfigMap).InNamespace("foons").List().MatchSelector("app in (web,api),!canary")), "match selector wrong")
+	assert.Equal(t, 1, count(mock.Type(ConfigMap).InNamespace("foons").List().MatchLabelSelector(&metav1.LabelSelector{
+		MatchLabels: map[string]string{"canary": "true"},
+	})), "match label selector wrong")
+	assert.Equal(t, 2, count(mock.Type(ConfigMap).InNamespace("foons").List().HasLabel("app", "web")), "has label wrong")
+
+	_, err := mock.Type(ConfigMap).InNamespace("foons").ListWithSelector("app in (web").Count()
+	assert.Error(t, err, "selector parse error not reported")
+}
+
+func TestObjectError(t *testing.T) {
+	cm := &corev1.ConfigMap{}
+	cm.Name = "testcm1"
+	cm.Namespace = "foons"
+	_, err := Mock(cm).Type(ConfigMap).InNamespace("foons").
+		Add(func() *corev1.ConfigMap {
+			return cm.DeepCopy()
+		}).Create()
+	assert.Error(t, err, "duplicated creation not reported")
+
+	var multiErr *ErrMultiLambdaFailure
+	assert.True(t, errors.As(err, &multiErr), "not a multi lambda failure")
+	assert.Equal(t, 1, len(multiErr.Errors()), "error count wrong")
+
+	var objErr *ObjectError
+	assert.True(t, errors.As(err, &objErr), "not an object error")
+	assert.Equal(t, VerbCreate, objErr.Verb, "verb wrong")
+	assert.Equal(t, "foons", objErr.Namespace, "namespace wrong")
+	assert.Equal(t, "testcm1", objErr.Name, "name wrong")
+	assert.True(t, apierrors.IsAlreadyExists(objErr.Err), "underlying error wrong")
+}
+
+func TestPatch(t *testing.T) {
+	cm := &corev1.ConfigMap{}
+	cm.Name = "testcm1"
+	cm.Namespace = "foons"
+	cm.Labels = map[string]string{"foo": "bar"}
+	cm.Data = map[string]string{"key": "value"}
+	mock := Mock(cm)
+
+	patched, err := mock.Type(ConfigMap).InNamespace("foons").List().
+		PatchMap(func(cm *corev1.ConfigMap) *corev1.ConfigMap {
+			cm.Labels["patched"] = "map"
+			return cm
+		})
+	assert.True(t, patched, "not patched")
+	assert.NoError(t, err, "some error")
+
+	patched, err = mock.Type(ConfigMap).InNamespace("foons").List().
+		Patch(types.MergePatchType, []byte(`{"data":{"merged":"true"}}`))
+	assert.True(t, patched, "not patched")
+	assert.NoError(t, err, "some error")
+
+	patched, err = mock.Type(ConfigMap).InNamespace("foons").List().
+		Patch(types.JSONPatchType, []byte(`[{"op":"add","path":"/metadata/annotations","value":{"json":"patch"}}]`))
+	assert.True(t, patched, "not patched")
+	assert.NoError(t, err, "some error")
+
+	obj, err := mock.Type(ConfigMap).InNamespace("foons").List().Element()
+	assert.NoError(t, err, "some error")
+	result := obj.(*corev1.ConfigMap)
+	assert.Equal(t, map[string]string{"foo": "bar", "patched": "map"}, result.Labels, "labels wrong")
+	assert.Equal(t, map[string]string{"key": "value", "merged": "true"}, result.Data, "data wrong")
+	assert.Equal(t, "patch", result.Annotations["json"], "annotations wrong")
+}
+
+func TestUpdateWithRetry(t *testing.T) {
+	cm := &corev1.ConfigMap{}
+	cm.Name = "testcm1"
+	cm.Namespace = "foons"
+	cm.Data = map[string]string{"count": "0"}
+	mock := Mock(cm)
+	conflicts := 2
+	fakeOf(mock).PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "testcm1", fmt.Errorf("conflict"))
+	})
+	results, err := mock.Type(ConfigMap).InNamespace("foons").List().NameEqual("testcm1").
+		UpdateWithRetry(func(cm *corev1.ConfigMap) *corev1.ConfigMap {
+			cm.Data["count"] = "1"
+			return cm
+		}, retry.DefaultRetry)
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, []RetryResult{{Namespace: "foons", Name: "testcm1", Attempts: 3, Updated: true}}, results, "result wrong")
+}
+
+func TestDeleteOptions(t *testing.T) {
+	cm := &corev1.ConfigMap{}
+	cm.Name = "testcm1"
+	cm.Namespace = "foons"
+	cm.UID = "uid1"
+	mock := Mock(cm)
+
+	lambda := mock.Type(ConfigMap).InNamespace("foons").List().DryRun()
+	deleted, err := lambda.DeleteForeground()
+	assert.NoError(t, err, "some error")
+	assert.True(t, deleted, "not deleted")
+	actions := lambda.Plan().Actions()
+	assert.Equal(t, 1, len(actions), "plan wrong")
+	assert.Equal(t, `{"preconditions":{"uid":"uid1"},"propagationPolicy":"Foreground"}`, actions[0].Diff, "options wrong")
+
+	// the element is stale and the object has been recreated with another UID since
+	stale := func() *Lambda {
+		return mock.Type(ConfigMap).InNamespace("foons").Add(func() *corev1.ConfigMap {
+			stale := cm.DeepCopy()
+			stale.UID = "uid0"
+			return stale
+		})
+	}
+	isConflict := func(err error) bool {
+		var objErr *ObjectError
+		return errors.As(err, &objErr) && apierrors.IsConflict(objErr.Err)
+	}
+	_, err = stale().Delete()
+	assert.True(t, isConflict(err), "precondition not applied by Delete")
+	_, err = stale().DeleteWithGracePeriod(0)
+	assert.True(t, isConflict(err), "precondition not applied by DeleteWithGracePeriod")
+	_, _, err = stale().DeleteIfExist()
+	assert.True(t, isConflict(err), "precondition not applied by DeleteIfExist")
+	count, err := mock.Type(ConfigMap).InNamespace("foons").List().Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 1, count, "recreated object deleted")
+
+	deleted, err = mock.Type(ConfigMap).InNamespace("foons").List().DeleteOrphan()
+	assert.NoError(t, err, "some error")
+	assert.True(t, deleted, "not deleted")
+	count, err = mock.Type(ConfigMap).InNamespace("foons").List().Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 0, count, "not deleted")
+}
+
+func TestWaitUntil(t *testing.T) {
+	pod := &corev1.Pod{}
+	pod.Name = "testpod1"
+	pod.Namespace = "foons"
+	pod.Status.Phase = corev1.PodPending
+	mock := Mock(pod)
+
+	running := func(pod *corev1.Pod) bool {
+		return pod.Status.Phase == corev1.PodRunning
+	}
+	// the informer is started by whichever lambda reads first
+	waiter, updater := mock.Type(Pod), mock.Type(Pod)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		updater.InNamespace("foons").List().
+			Map(func(pod *corev1.Pod) *corev1.Pod {
+				pod = pod.DeepCopy()
+				pod.Status.Phase = corev1.PodRunning
+				return pod
+			}).
+			Update()
+	}()
+	err := waiter.InNamespace("foons").List().WaitUntil(running, 5*time.Second)
+	assert.NoError(t, err, "some error")
+
+	err = Of[*corev1.Pod](mock, Pod).InNamespace("foons").List().
+		WaitUntilAny(func(pod *corev1.Pod) bool {
+			return pod.Status.Phase == corev1.PodSucceeded
+		}, 100*time.Millisecond)
+	var timeoutErr *WaitTimeoutError
+	assert.True(t, errors.As(err, &timeoutErr), "not timed out")
+	assert.Equal(t, []string{"foons/testpod1"}, timeoutErr.Pending, "pending wrong")
+}
+
+func TestWaitUntilUnsubscribes(t *testing.T) {
+	pod := &corev1.Pod{}
+	pod.Name = "testpod1"
+	pod.Namespace = "foons"
+	mock := Mock(pod)
+
+	for i := 0; i < 50; i++ {
+		err := Of[*corev1.Pod](mock, Pod).InNamespace("foons").List().
+			WaitUntil(func(pod *corev1.Pod) bool {
+				return pod.Name == "testpod1"
+			}, time.Second)
+		assert.NoError(t, err, "some error")
+	}
+	assert.Equal(t, 1, len(mock.(*kubernetesClientLambdaImpl).dispatchers.dispatchers), "handler registered more than once")
+	assertUnsubscribed(t, mock)
+}
+
+// assertUnsubscribed checks that no lambda is left subscribing to the informers
+func assertUnsubscribed(t *testing.T, kcl KubernetesClientLambda) {
+	for _, d := range kcl.(*kubernetesClientLambdaImpl).dispatchers.dispatchers {
+		assert.Empty(t, d.subscribers(), "subscription left behind")
+	}
+}
+
+func TestDeleteAndWait(t *testing.T) {
+	cm := &corev1.ConfigMap{}
+	cm.Name = "testcm1"
+	cm.Namespace = "foons"
+	cm.UID = "uid1"
+	mock := Mock(cm)
+	deleted, err := mock.Type(ConfigMap).InNamespace("foons").List().DeleteAndWait(5 * time.Second)
+	assert.NoError(t, err, "some error")
+	assert.True(t, deleted, "not deleted")
+	count, err := mock.Type(ConfigMap).InNamespace("foons").List().Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 0, count, "not deleted")
+	assertUnsubscribed(t, mock)
+
+	cm = cm.DeepCopy()
+	cm.Finalizers = []string{"example.com/protect"}
+	mock = Mock(cm)
+	// apiserver defers the deletion until the finalizers are removed
+	fakeOf(mock).PrependReactor("delete", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	deleted, err = mock.Type(ConfigMap).InNamespace("foons").List().DeleteAndWait(100 * time.Millisecond)
+	assert.True(t, deleted, "not deleted")
+	var timeoutErr *WaitTimeoutError
+	assert.True(t, errors.As(err, &timeoutErr), "not timed out")
+	assert.Equal(t, []string{"foons/testcm1"}, timeoutErr.Pending, "pending wrong")
+	assert.Equal(t, map[string][]string{"foons/testcm1": {"example.com/protect"}}, timeoutErr.Finalizers, "finalizers wrong")
+	assertUnsubscribed(t, mock)
+}
+
+func TestScale(t *testing.T) {
+	replicas := int32(2)
+	deploy := &appsv1.Deployment{}
+	deploy.Name = "testdeploy1"
+	deploy.Namespace = "foons"
+	deploy.Spec.Replicas = &replicas
+	mock := Mock(deploy)
+
+	replicasEqual := func(expected int32) func(*appsv1.Deployment) bool {
+		return func(deploy *appsv1.Deployment) bool {
+			return deploy.Spec.Replicas != nil && *deploy.Spec.Replicas == expected
+		}
+	}
+	scaled, err := mock.Type(Deployment).InNamespace("foons").List().NameEqual("testdeploy1").Scale(3)
+	assert.NoError(t, err, "some error")
+	assert.True(t, scaled, "not scaled")
+	err = Of[*appsv1.Deployment](mock, Deployment).InNamespace("foons").List().WaitUntil(replicasEqual(3), 5*time.Second)
+	assert.NoError(t, err, "replicas not updated")
+
+	scaled, err = mock.Type(Deployment).InNamespace("foons").List().ScaleBy(func(current int32) int32 {
+		return current * 2
+	})
+	assert.NoError(t, err, "some error")
+	assert.True(t, scaled, "not scaled")
+	err = Of[*appsv1.Deployment](mock, Deployment).InNamespace("foons").List().WaitUntil(replicasEqual(6), 5*time.Second)
+	assert.NoError(t, err, "replicas not updated")
+
+	lambda := mock.Type(Deployment).InNamespace("foons").List().DryRun()
+	_, err = lambda.ScaleBy(func(current int32) int32 {
+		return current + 1
+	})
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, `scale Deployments foons/testdeploy1 {"spec":{"replicas":7}}`, lambda.Plan().String(), "plan wrong")
+
+	_, err = mock.Type(ConfigMap).InNamespace("foons").List().Scale(1)
+	assert.Error(t, err, "configmap scaled")
+}
+
+func TestUpdateStatus(t *testing.T) {
+	pod := &corev1.Pod{}
+	pod.Name = "testpod1"
+	pod.Namespace = "foons"
+	mock := Mock(pod)
+
+	phaseEqual := func(phase corev1.PodPhase) func(*corev1.Pod) bool {
+		return func(pod *corev1.Pod) bool {
+			return pod.Status.Phase == phase
+		}
+	}
+	updated, err := mock.Type(Pod).InNamespace("foons").List().
+		Map(func(pod *corev1.Pod) *corev1.Pod {
+			pod = pod.DeepCopy()
+			pod.Status.Phase = corev1.PodRunning
+			return pod
+		}).
+		UpdateStatus()
+	assert.NoError(t, err, "some error")
+	assert.True(t, updated, "not updated")
+	err = Of[*corev1.Pod](mock, Pod).InNamespace("foons").List().WaitUntil(phaseEqual(corev1.PodRunning), 5*time.Second)
+	assert.NoError(t, err, "status not updated")
+
+	patched, err := mock.Type(Pod).InNamespace("foons").List().
+		PatchStatus(types.MergePatchType, []byte(`{"status":{"phase":"Succeeded"}}`))
+	assert.NoError(t, err, "some error")
+	assert.True(t, patched, "not patched")
+	err = Of[*corev1.Pod](mock, Pod).InNamespace("foons").List().WaitUntil(phaseEqual(corev1.PodSucceeded), 5*time.Second)
+	assert.NoError(t, err, "status not patched")
+
+	lambda := mock.Type(Pod).InNamespace("foons").List().
+		Map(func(pod *corev1.Pod) *corev1.Pod {
+			pod = pod.DeepCopy()
+			pod.Status.Phase = corev1.PodFailed
+			return pod
+		}).
+		DryRun()
+	_, err = lambda.UpdateStatus()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, `update status Pods foons/testpod1 {"status":{"phase":"Failed"}}`, lambda.Plan().String(), "plan wrong")
+
+	_, err = mock.Type(ConfigMap).InNamespace("foons").List().UpdateStatus()
+	assert.Error(t, err, "configmap status updated")
+}
+
+func TestDrain(t *testing.T) {
+	node := &corev1.Node{}
+	node.Name = "node1"
+	newPod := func(name, nodeName string) *corev1.Pod {
+		pod := &corev1.Pod{}
+		pod.Name = name
+		pod.Namespace = "foons"
+		pod.Spec.NodeName = nodeName
+		return pod
+	}
+	web := newPod("web", "node1")
+	web.Labels = map[string]string{"app": "web"}
+	api := newPod("api", "node1")
+	ds := newPod("ds", "node1")
+	ds.OwnerReferences = []metav1.OwnerReference{{Kind: "DaemonSet", Name: "ds"}}
+	mirror := newPod("mirror", "node1")
+	mirror.Annotations = map[string]string{mirrorPodAnnotation: "true"}
+	other := newPod("other", "node2")
+	pdb := &policyv1beta1.PodDisruptionBudget{}
+	pdb.Name = "web"
+	pdb.Namespace = "foons"
+	pdb.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	mock := Mock(node, web, api, ds, mirror, other, pdb)
+
+	unschedulable := func(expected bool) func(*corev1.Node) bool {
+		return func(node *corev1.Node) bool {
+			return node.Spec.Unschedulable == expected
+		}
+	}
+	drained, err := mock.Type(Node).InNamespace().List().NameEqual("node1").Drain(DrainOptions{Timeout: 300 * time.Millisecond})
+	assert.False(t, drained, "drained")
+	var drainErr *DrainError
+	assert.True(t, errors.As(err, &drainErr), "not blocked")
+	assert.Equal(t, "node1", drainErr.Node, "node wrong")
+	assert.Equal(t, []string{"foons/web"}, drainErr.Blocked, "blocked wrong")
+	assert.True(t, apierrors.IsTooManyRequests(drainErr.Errors["foons/web"]), "not blocked by pdb")
+	assertUnsubscribed(t, mock)
+	err = Of[*corev1.Node](mock, Node).InNamespace().List().WaitUntil(unschedulable(true), 5*time.Second)
+	assert.NoError(t, err, "not cordoned")
+	names := []string{}
+	err = Of[*corev1.Pod](mock, Pod).InNamespace("foons").List().SortByName().Each(func(pod *corev1.Pod) {
+		names = append(names, pod.Name)
+	})
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, []string{"ds", "mirror", "other", "web"}, names, "pods wrong")
+
+	uncordoned, err := mock.Type(Node).InNamespace().List().Uncordon()
+	assert.NoError(t, err, "some error")
+	assert.True(t, uncordoned, "not uncordoned")
+	err = Of[*corev1.Node](mock, Node).InNamespace().List().WaitUntil(unschedulable(false), 5*time.Second)
+	assert.NoError(t, err, "not uncordoned")
+
+	lambda := mock.Type(Node).InNamespace().List().DryRun()
+	drained, err = lambda.Drain(DrainOptions{Timeout: 300 * time.Millisecond})
+	// disruption budgets are only evaluated by the apiserver
+	assert.NoError(t, err, "some error")
+	assert.True(t, drained, "not drained")
+	actions := lambda.Plan().Actions()
+	assert.Equal(t, 2, len(actions), "plan wrong")
+	assert.Equal(t, VerbPatch, actions[0].Verb, "not cordoned")
+	assert.Equal(t, VerbEvict, actions[1].Verb, "not evicted")
+	assert.Equal(t, "web", actions[1].Name, "pod wrong")
+
+	_, err = mock.Type(ConfigMap).InNamespace("foons").List().Cordon()
+	assert.Error(t, err, "configmap cordoned")
+}
+
+func TestDrainWithoutEvictablePods(t *testing.T) {
+	node1 := &corev1.Node{}
+	node1.Name = "node1"
+	node2 := &corev1.Node{}
+	node2.Name = "node2"
+	ds := &corev1.Pod{}
+	ds.Name = "ds"
+	ds.Namespace = "foons"
+	ds.Spec.NodeName = "node2"
+	ds.OwnerReferences = []metav1.OwnerReference{{Kind: "DaemonSet", Name: "ds"}}
+	mock := Mock(node1, node2, ds)
+
+	drained, err := mock.Type(Node).InNamespace().List().NameEqual("node1").Drain(DrainOptions{Timeout: time.Second})
+	assert.NoError(t, err, "empty node not drained")
+	assert.True(t, drained, "empty node not drained")
+	drained, err = mock.Type(Node).InNamespace().List().NameEqual("node2").Drain(DrainOptions{Timeout: time.Second})
+	assert.NoError(t, err, "daemonset-only node not drained")
+	assert.True(t, drained, "daemonset-only node not drained")
+
+	mock = MockWithOptions([]Option{WithCacheSyncTimeout(200 * time.Millisecond)}, node1)
+	fakeOf(mock).PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", fmt.Errorf("forbidden"))
+	})
+	drained, err = mock.Type(Node).InNamespace().List().Drain(DrainOptions{Timeout: time.Second})
+	assert.False(t, drained, "drained")
+	var objErr *ObjectError
+	assert.True(t, errors.As(err, &objErr), "listing failure not reported")
+	assert.Equal(t, VerbList, objErr.Verb, "verb wrong")
+}
+
+func TestDrainTimeoutWhileEvicted(t *testing.T) {
+	node := &corev1.Node{}
+	node.Name = "node1"
+	web := &corev1.Pod{}
+	web.Name = "web"
+	web.Namespace = "foons"
+	web.Labels = map[string]string{"app": "web"}
+	web.Spec.NodeName = "node1"
+	slow := web.DeepCopy()
+	slow.Name = "slow"
+	slow.Labels = nil
+	pdb := &policyv1beta1.PodDisruptionBudget{}
+	pdb.Name = "web"
+	pdb.Namespace = "foons"
+	pdb.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	mock := Mock(node, web, slow, pdb)
+	// the eviction of slow is accepted but the pod lingers, e.g. terminating gracefully
+	fakeOf(mock).PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		create, ok := action.(k8stesting.CreateAction)
+		if !ok || action.GetSubresource() != SubresourceEviction {
+			return false, nil, nil
+		}
+		accessor, err := meta.Accessor(create.GetObject())
+		return err == nil && accessor.GetName() == "slow", nil, nil
+	})
+
+	result := make(chan error)
+	go func() {
+		_, err := mock.Type(Node).InNamespace().List().Drain(DrainOptions{Timeout: 300 * time.Millisecond})
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		var drainErr *DrainError
+		assert.True(t, errors.As(err, &drainErr), "not blocked")
+		assert.Equal(t, []string{"foons/web", "foons/slow"}, drainErr.Blocked, "blocked wrong")
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain hangs after the timeout")
+	}
+	assertUnsubscribed(t, mock)
+}
+
+func TestLive(t *testing.T) {
+	var objects []runtime.Object
+	for i := 0; i < 5; i++ {
+		cm := &corev1.ConfigMap{}
+		cm.Name = fmt.Sprintf("testcm%d", i)
+		cm.Namespace = "foons"
+		if i == 0 {
+			cm.Labels = map[string]string{"app": "foo"}
+		}
+		objects = append(objects, cm)
+	}
+	mock := MockWithOptions([]Option{WithPageSize(2)}, objects...)
+	fakes := mock.(*kubernetesClientLambdaImpl).clientPool.(*FakeClientPool)
+
+	var names []string
+	err := Of[*corev1.ConfigMap](mock, ConfigMap).InNamespaceLive("foons").List().Each(func(cm *corev1.ConfigMap) {
+		names = append(names, cm.Name)
+	})
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, []string{"testcm0", "testcm1", "testcm2", "testcm3", "testcm4"}, names, "pages not streamed in order")
+	var lists int
+	for _, action := range fakes.Actions() {
+		assert.NotEqual(t, "watch", action.GetVerb(), "informer started by live read")
+		if action.GetVerb() == "list" {
+			lists++
+		}
+	}
+	assert.Equal(t, 3, lists, "not paginated")
+
+	count, err := mock.Type(ConfigMap).InNamespaceLive("foons").ListWithSelector("app=foo").Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 1, count, "selector not applied")
+
+	_, existed, err := mock.Type(ConfigMap).InNamespaceLive("foons").Add(func() *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{}
+		cm.Name = "testcm0"
+		cm.Namespace = "foons"
+		return cm
+	}).CreateIfNotExist()
+	assert.NoError(t, err, "some error")
+	assert.True(t, existed, "live get missed the object")
+
+	count, err = mock.Type(ConfigMap).InNamespace("foons").List().Live().NameEqual("testcm1").Count()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 1, count, "elements lost switching to live")
+}
+
+// fakeOf returns the fake shared by the clients of the mock
+func fakeOf(kcl KubernetesClientLambda) *k8stesting.Fake {
+	return kcl.(*kubernetesClientLambdaImpl).clientPool.(*FakeClientPool).Fake
+}
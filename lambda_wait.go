@@ -0,0 +1,308 @@
+package lambda
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// WaitTimeoutError reports the elements which still don't satisfy the condition when timed out
+type WaitTimeoutError struct {
+	Resource Resource
+	Timeout  time.Duration
+	// Pending are the elements in namespace/name format
+	Pending []string
+	// Finalizers remaining on the pending elements, only reported by DeleteAndWait
+	Finalizers map[string][]string
+}
+
+func (e *WaitTimeoutError) Error() string {
+	pending := make([]string, 0, len(e.Pending))
+	for _, key := range e.Pending {
+		if finalizers := e.Finalizers[key]; len(finalizers) > 0 {
+			key = fmt.Sprintf("%s (finalizers: %s)", key, strings.Join(finalizers, ", "))
+		}
+		pending = append(pending, key)
+	}
+	return fmt.Sprintf("timed out after %v waiting for %s: %s", e.Timeout, e.Resource.Name, strings.Join(pending, ", "))
+}
+
+// WaitUntil blocks until every element satisfies the predicate. The elements are read from the
+// local cache again whenever the informer observes a change of the resource. A WaitTimeoutError
+// listing the elements left behind is returned if it doesn't complete within the timeout.
+func (lambda *Lambda) WaitUntil(predicate Predicate, timeout time.Duration) error {
+	return lambda.waitUntil(func(item runtime.Object) bool {
+		return callPredicate(predicate, item)
+	}, true, timeout)
+}
+
+// WaitUntilAny blocks until any element satisfies the predicate, see WaitUntil
+func (lambda *Lambda) WaitUntilAny(predicate Predicate, timeout time.Duration) error {
+	return lambda.waitUntil(func(item runtime.Object) bool {
+		return callPredicate(predicate, item)
+	}, false, timeout)
+}
+
+func (lambda *Lambda) waitUntil(predicate func(runtime.Object) bool, all bool, timeout time.Duration) error {
+	return lambda.run(
+		func() {
+			if lambda.watchFunc == nil {
+				lambda.addError(fmt.Errorf("no informer bound to lambda of %s", lambda.rs.Name))
+				drain(lambda.val)
+				return
+			}
+			// the handler is registered before reading the cache so that no change is missed
+			changed := make(chan struct{}, 1)
+			notify := func(interface{}) {
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+			unsubscribe, err := lambda.watchFunc(cache.ResourceEventHandlerFuncs{
+				AddFunc: notify,
+				UpdateFunc: func(_, obj interface{}) {
+					notify(obj)
+				},
+				DeleteFunc: notify,
+			})
+			if err != nil {
+				lambda.addError(err)
+				drain(lambda.val)
+				return
+			}
+			defer unsubscribe()
+
+			var pending []types.NamespacedName
+			lambda.forEach(func(item runtime.Object) bool {
+				accessor, err := meta.Accessor(item)
+				if err != nil {
+					lambda.addError(err)
+					return true
+				}
+				pending = append(pending, types.NamespacedName{Namespace: accessor.GetNamespace(), Name: accessor.GetName()})
+				return true
+			})
+			if len(pending) == 0 {
+				return
+			}
+
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			for {
+				var remaining []types.NamespacedName
+				for _, key := range pending {
+					if item, err := lambda.getFunc(key.Namespace, key.Name); err == nil && predicate(item) {
+						if !all {
+							return
+						}
+						continue
+					}
+					remaining = append(remaining, key)
+				}
+				pending = remaining
+				if len(pending) == 0 {
+					return
+				}
+				select {
+				case <-lambda.ctx.Done():
+					return
+				case <-timer.C:
+					timeoutErr := &WaitTimeoutError{
+						Resource: lambda.rs,
+						Timeout:  timeout,
+					}
+					for _, key := range pending {
+						timeoutErr.Pending = append(timeoutErr.Pending, key.String())
+					}
+					lambda.addError(timeoutErr)
+					return
+				case <-changed:
+				}
+			}
+		},
+	)
+}
+
+// deletion identifies an object by its UID so that the one recreated with the same name
+// isn't mistaken for it
+type deletion struct {
+	key types.NamespacedName
+	uid types.UID
+}
+
+func deletionOf(object runtime.Object) (deletion, error) {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return deletion{}, err
+	}
+	return deletion{
+		key: types.NamespacedName{Namespace: accessor.GetNamespace(), Name: accessor.GetName()},
+		uid: accessor.GetUID(),
+	}, nil
+}
+
+// deletionWatcher records the objects deleted observed by the informer
+type deletionWatcher struct {
+	lambda      *Lambda
+	lock        sync.Mutex
+	gone        map[types.NamespacedName]types.UID
+	changed     chan struct{}
+	unsubscribe func()
+}
+
+// watchDeletion subscribes a deletion watcher to the informer, which must be done
+// before deleting so that no deletion is missed. The watcher must be stopped once done.
+func (lambda *Lambda) watchDeletion() (*deletionWatcher, error) {
+	if lambda.watchFunc == nil {
+		return nil, fmt.Errorf("no informer bound to lambda of %s", lambda.rs.Name)
+	}
+	w := &deletionWatcher{
+		lambda:  lambda,
+		gone:    make(map[types.NamespacedName]types.UID),
+		changed: make(chan struct{}, 1),
+	}
+	unsubscribe, err := lambda.watchFunc(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			object, ok := obj.(runtime.Object)
+			if !ok {
+				return
+			}
+			d, err := deletionOf(object)
+			if err != nil {
+				return
+			}
+			w.lock.Lock()
+			w.gone[d.key] = d.uid
+			w.lock.Unlock()
+			select {
+			case w.changed <- struct{}{}:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	w.unsubscribe = unsubscribe
+	return w, nil
+}
+
+// stop unsubscribes the watcher from the informer
+func (w *deletionWatcher) stop() {
+	w.unsubscribe()
+}
+
+// deadlineAfter returns a channel closed when the timeout elapses. Unlike the channel of a
+// timer it's never drained, so that every stage selecting on it sees the deadline.
+func deadlineAfter(timeout time.Duration) (deadline <-chan struct{}, stop func()) {
+	ch := make(chan struct{})
+	timer := time.AfterFunc(timeout, func() { close(ch) })
+	return ch, func() { timer.Stop() }
+}
+
+// wait blocks until every object is gone or the deadline is reached, returning the
+// objects left behind and their remaining finalizers keyed by namespace/name
+func (w *deletionWatcher) wait(pending []deletion, deadline <-chan struct{}) ([]deletion, map[string][]string) {
+	finalizers := make(map[string][]string)
+	for {
+		var remaining []deletion
+		for _, d := range pending {
+			w.lock.Lock()
+			uid, ok := w.gone[d.key]
+			w.lock.Unlock()
+			if ok && uid == d.uid {
+				continue
+			}
+			item, err := w.lambda.getFunc(d.key.Namespace, d.key.Name)
+			if err != nil {
+				continue
+			}
+			accessor, err := meta.Accessor(item)
+			if err != nil || accessor.GetUID() != d.uid {
+				// recreated with the same name
+				continue
+			}
+			finalizers[d.key.String()] = accessor.GetFinalizers()
+			remaining = append(remaining, d)
+		}
+		pending = remaining
+		if len(pending) == 0 {
+			return nil, nil
+		}
+		select {
+		case <-w.lambda.ctx.Done():
+			return pending, finalizers
+		case <-deadline:
+			return pending, finalizers
+		case <-w.changed:
+		}
+	}
+}
+
+// DeleteAndWait removes every element and blocks until the informer observes the deletion of
+// the very object by its UID, which may be deferred by finalizers or graceful termination.
+// A WaitTimeoutError reporting the objects stuck and their remaining finalizers is returned if
+// they're not gone within the timeout.
+func (lambda *Lambda) DeleteAndWait(timeout time.Duration) (deleted bool, err error) {
+	err = lambda.run(
+		func() {
+			watcher, err := lambda.watchDeletion()
+			if err != nil {
+				lambda.addError(err)
+				drain(lambda.val)
+				return
+			}
+			defer watcher.stop()
+			var pending []deletion
+			lambda.forEach(func(item runtime.Object) bool {
+				d, err := deletionOf(item)
+				if err != nil {
+					lambda.addError(err)
+					return true
+				}
+				if err := lambda.deleteFunc(item, deleteOptionsFor(nil, item)); err != nil {
+					lambda.addObjectError(VerbDelete, item, err)
+					return true
+				}
+				deleted = true
+				pending = append(pending, d)
+				return true
+			})
+			if lambda.plan != nil || len(pending) == 0 {
+				// nothing is actually deleted in dry run
+				return
+			}
+
+			deadline, stop := deadlineAfter(timeout)
+			defer stop()
+			pending, finalizers := watcher.wait(pending, deadline)
+			if len(pending) == 0 || lambda.ctx.Err() != nil {
+				return
+			}
+			timeoutErr := &WaitTimeoutError{
+				Resource:   lambda.rs,
+				Timeout:    timeout,
+				Finalizers: make(map[string][]string),
+			}
+			for _, d := range pending {
+				key := d.key.String()
+				timeoutErr.Pending = append(timeoutErr.Pending, key)
+				if len(finalizers[key]) > 0 {
+					timeoutErr.Finalizers[key] = finalizers[key]
+				}
+			}
+			lambda.addError(timeoutErr)
+		},
+	)
+	return
+}
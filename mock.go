@@ -2,45 +2,128 @@ package lambda
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	fakediscovery "k8s.io/client-go/discovery/fake"
 	"k8s.io/client-go/dynamic"
 	dynamic_fake "k8s.io/client-go/dynamic/fake"
-	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/testing"
 	"k8s.io/client-go/util/flowcontrol"
 )
 
 // the mock KubernetesClient is statusful and if you want to reset its status then use MockReset
 func Mock(objects ...runtime.Object) KubernetesClientLambda {
+	return MockWithOptions(nil, objects...)
+}
+
+// MockWithOptions creates the mock KubernetesClient configured by the options, the informers
+// don't resync unless WithResync is given. It panics if the selectors are invalid.
+func MockWithOptions(opts []Option, objects ...runtime.Object) KubernetesClientLambda {
+	options := newClientOptions(append([]Option{WithResync(0)}, opts...))
+	if err := options.validate(); err != nil {
+		panic(err)
+	}
 	fakePool, fakeClient := NewFakes(objects...)
 	return &kubernetesClientLambdaImpl{
-		clientPool:      fakePool,
-		informerFactory: informers.NewSharedInformerFactory(fakeClient, 0),
+		clientPool:        fakePool,
+		informerFactories: options.newInformerFactories(fakeClient),
+		cacheSyncTimeout:  options.cacheSyncTimeout,
+		pageSize:          options.pageSize,
+		subresources:      newDiscoveryIndexer(fakeClient.Discovery()),
 	}
 }
 
 func NewFakes(objects ...runtime.Object) (dynamic.ClientPool, kubernetes.Interface) {
 	fakeClientset := fake.NewSimpleClientset(objects...)
+	// the discovery holds the fake the clientset is copied from
+	fakeClientset.Discovery().(*fakediscovery.FakeDiscovery).Resources = fakeAPIResources()
 	fakeClientset.Fake.ReactionChain = []testing.Reactor{
 		kclReactorWrapper(fakeClientset.ReactionChain[0]),
 	}
 	return &FakeClientPool{&(fakeClientset.Fake)}, fakeClientset
 }
 
+// fakeSubresources are the subresources served by apiserver for the supported resources
+var fakeSubresources = map[Resource][]string{
+	Pod:                       {SubresourceStatus, SubresourceEviction},
+	Namespace:                 {SubresourceStatus},
+	Node:                      {SubresourceStatus},
+	Service:                   {SubresourceStatus},
+	ResourceQuota:             {SubresourceStatus},
+	PersistentVolume:          {SubresourceStatus},
+	PersistentVolumeClaim:     {SubresourceStatus},
+	ReplicationController:     {SubresourceStatus, SubresourceScale},
+	Ingress:                   {SubresourceStatus},
+	ReplicaSet:                {SubresourceStatus, SubresourceScale},
+	Deployment:                {SubresourceStatus, SubresourceScale},
+	DaemonSet:                 {SubresourceStatus},
+	StatefulSet:               {SubresourceStatus, SubresourceScale},
+	Job:                       {SubresourceStatus},
+	CronJob:                   {SubresourceStatus},
+	HorizontalPodAutoscalerV1: {SubresourceStatus},
+	HorizontalPodAutoscalerV2: {SubresourceStatus},
+}
+
+// fakeAPIResources returns the api resources served by the fake discovery, including the
+// "resource/subresource" entries of fakeSubresources
+func fakeAPIResources() []*metav1.APIResourceList {
+	lists := make(map[string]*metav1.APIResourceList)
+	var groupVersions []string
+	for _, rs := range GetResources() {
+		api := GetResouceIndexerInstance().GetAPIResource(rs)
+		if api == nil {
+			continue
+		}
+		groupVersion := schema.GroupVersion{Group: api.Group, Version: api.Version}.String()
+		list, ok := lists[groupVersion]
+		if !ok {
+			list = &metav1.APIResourceList{GroupVersion: groupVersion}
+			lists[groupVersion] = list
+			groupVersions = append(groupVersions, groupVersion)
+		}
+		list.APIResources = append(list.APIResources, *api)
+		for _, subresource := range fakeSubresources[rs] {
+			sub := *api
+			sub.Name += "/" + subresource
+			list.APIResources = append(list.APIResources, sub)
+		}
+	}
+	resources := make([]*metav1.APIResourceList, 0, len(groupVersions))
+	for _, groupVersion := range groupVersions {
+		resources = append(resources, lists[groupVersion])
+	}
+	return resources
+}
+
 func kclReactorWrapper(reactor testing.Reactor) testing.Reactor {
 	return &testing.SimpleReactor{
 		Verb:     "*",
 		Resource: "*",
 		Reaction: func(action testing.Action) (handled bool, ret runtime.Object, err error) {
+			switch action.GetSubresource() {
+			case SubresourceScale:
+				return reactScale(reactor, action)
+			case SubresourceEviction:
+				return reactEviction(reactor, action)
+			}
 			isUnstructured := false
 			switch typedAction := action.(type) {
 			case testing.CreateActionImpl:
@@ -113,6 +196,112 @@ func kclReactorWrapper(reactor testing.Reactor) testing.Reactor {
 	}
 }
 
+// reactScale emulates the scale subresource with spec.replicas of the parent object,
+// since the object tracker of the fake clientset doesn't serve subresources.
+func reactScale(reactor testing.Reactor, action testing.Action) (bool, runtime.Object, error) {
+	var name string
+	var desired *int64
+	switch action := action.(type) {
+	case testing.GetActionImpl:
+		name = action.GetName()
+	case testing.UpdateActionImpl:
+		scale, err := castObjectToUnstructured(action.GetObject())
+		if err != nil {
+			return true, nil, err
+		}
+		name = scale.GetName()
+		replicas := int64(getReplicas(scale))
+		desired = &replicas
+	default:
+		return false, nil, nil
+	}
+	_, obj, err := reactor.React(testing.NewGetAction(action.GetResource(), action.GetNamespace(), name))
+	if err != nil {
+		return true, nil, err
+	}
+	gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil {
+		return true, nil, err
+	}
+	obj = obj.DeepCopyObject()
+	obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+	parent, err := castObjectToUnstructured(obj)
+	if err != nil {
+		return true, nil, err
+	}
+	if desired != nil {
+		if err := unstructured.SetNestedField(parent.Object, *desired, "spec", "replicas"); err != nil {
+			return true, nil, err
+		}
+		obj, err := castUnstructuredToObject(gvks[0], parent)
+		if err != nil {
+			return true, nil, err
+		}
+		if _, _, err := reactor.React(testing.NewUpdateAction(action.GetResource(), action.GetNamespace(), obj)); err != nil {
+			return true, nil, err
+		}
+	}
+	scale := &autoscalingv1.Scale{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Scale",
+			APIVersion: autoscalingv1.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      parent.GetName(),
+			Namespace: parent.GetNamespace(),
+		},
+	}
+	scale.Spec.Replicas = getReplicas(parent)
+	if replicas, found, err := unstructured.NestedInt64(parent.Object, "status", "replicas"); err == nil && found {
+		scale.Status.Replicas = int32(replicas)
+	}
+	return true, scale, nil
+}
+
+// reactEviction emulates the eviction subresource by deleting the pod unless a
+// PodDisruptionBudget selecting it allows no more disruption.
+func reactEviction(reactor testing.Reactor, action testing.Action) (bool, runtime.Object, error) {
+	create, ok := action.(testing.CreateActionImpl)
+	if !ok {
+		return false, nil, nil
+	}
+	eviction, err := castObjectToUnstructured(create.GetObject())
+	if err != nil {
+		return true, nil, err
+	}
+	namespace, name := action.GetNamespace(), eviction.GetName()
+	_, obj, err := reactor.React(testing.NewGetAction(action.GetResource(), namespace, name))
+	if err != nil {
+		return true, nil, err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return true, nil, err
+	}
+	pdbResource := policyv1beta1.SchemeGroupVersion.WithResource("poddisruptionbudgets")
+	pdbKind := policyv1beta1.SchemeGroupVersion.WithKind("PodDisruptionBudget")
+	_, list, err := reactor.React(testing.NewListAction(pdbResource, pdbKind, namespace, metav1.ListOptions{}))
+	if err != nil {
+		return true, nil, err
+	}
+	pdbs, err := meta.ExtractList(list)
+	if err != nil {
+		return true, nil, err
+	}
+	for _, item := range pdbs {
+		pdb := item.(*policyv1beta1.PodDisruptionBudget)
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			return true, nil, err
+		}
+		if selector.Matches(labels.Set(accessor.GetLabels())) && pdb.Status.PodDisruptionsAllowed <= 0 {
+			return true, nil, apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+		}
+	}
+	_, _, err = reactor.React(testing.NewDeleteAction(action.GetResource(), namespace, name))
+	return true, nil, err
+}
+
 // FakeClientPool provides a fake implementation of dynamic.ClientPool.
 // It assumes resource GroupVersions are the same as their corresponding kind GroupVersions.
 type FakeClientPool struct {
@@ -151,14 +340,19 @@ func (c *FakeClient) GetRateLimiter() flowcontrol.RateLimiter {
 // group and version.  If resource is not a namespaced resource, then namespace
 // is ignored.  The ResourceClient inherits the parameter codec of this client
 func (c *FakeClient) Resource(resource *metav1.APIResource, namespace string) dynamic.ResourceInterface {
+	resourceName, subresource := resource.Name, ""
+	if parts := strings.SplitN(resource.Name, "/", 2); len(parts) == 2 {
+		resourceName, subresource = parts[0], parts[1]
+	}
 	return &FakeResourceClient{
 		FakeResourceClient: &dynamic_fake.FakeResourceClient{
-			Resource:  c.GroupVersion.WithResource(resource.Name),
+			Resource:  c.GroupVersion.WithResource(resourceName),
 			Kind:      c.GroupVersion.WithKind(resource.Kind),
 			Namespace: namespace,
 
 			Fake: c.Fake,
 		},
+		subresource: subresource,
 	}
 }
 
@@ -174,17 +368,49 @@ func (c *FakeClient) ParameterCodec(parameterCodec runtime.ParameterCodec) dynam
 // FakeResourceClient is a fake implementation of dynamic.ResourceInterface
 type FakeResourceClient struct {
 	*dynamic_fake.FakeResourceClient
+	// subresource is set if the client is for a subresource, e.g. scale
+	subresource string
+}
+
+// Delete checks the UID precondition against the stored object as apiserver does, since
+// the delete action of the fake drops the delete options.
+func (c *FakeResourceClient) Delete(name string, opts *metav1.DeleteOptions) error {
+	if opts != nil && opts.Preconditions != nil && opts.Preconditions.UID != nil {
+		obj, err := c.Fake.
+			Invokes(testing.NewGetAction(c.Resource, c.Namespace, name), &unstructured.Unstructured{})
+		if obj == nil {
+			return err
+		}
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return err
+		}
+		if uid := *opts.Preconditions.UID; accessor.GetUID() != uid {
+			return apierrors.NewConflict(c.Resource.GroupResource(), name,
+				fmt.Errorf("Precondition failed: UID in precondition: %v, UID in object meta: %v", uid, accessor.GetUID()))
+		}
+	}
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(c.Resource, c.Namespace, name), &unstructured.Unstructured{})
+	return err
 }
 
 // Get gets the resource with the specified name.
 func (c *FakeResourceClient) Get(name string, opts metav1.GetOptions) (*unstructured.Unstructured, error) {
+	action := testing.NewGetAction(c.Resource, c.Namespace, name)
+	if c.subresource != "" {
+		action = testing.NewGetSubresourceAction(c.Resource, c.Namespace, c.subresource, name)
+	}
 	obj, err := c.Fake.
-		Invokes(testing.NewGetAction(c.Resource, c.Namespace, name), &unstructured.Unstructured{})
+		Invokes(action, &unstructured.Unstructured{})
 
 	if obj == nil {
 		return nil, err
 	}
 
+	if obj.GetObjectKind().GroupVersionKind().Empty() {
+		obj.GetObjectKind().SetGroupVersionKind(c.Kind)
+	}
 	unstructuredObj, err := castObjectToUnstructured(obj)
 	if err != nil {
 		return nil, err
@@ -192,6 +418,34 @@ func (c *FakeResourceClient) Get(name string, opts metav1.GetOptions) (*unstruct
 	return unstructuredObj, err
 }
 
+// Create creates the resource or its subresource
+func (c *FakeResourceClient) Create(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if c.subresource == "" {
+		return c.FakeResourceClient.Create(obj)
+	}
+	ret, err := c.Fake.
+		Invokes(testing.NewCreateSubresourceAction(c.Resource, obj.GetName(), c.subresource, c.Namespace, obj), &unstructured.Unstructured{})
+
+	if ret == nil {
+		return nil, err
+	}
+	return castObjectToUnstructured(ret)
+}
+
+// Update updates the resource or its subresource
+func (c *FakeResourceClient) Update(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if c.subresource == "" {
+		return c.FakeResourceClient.Update(obj)
+	}
+	ret, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(c.Resource, c.subresource, c.Namespace, obj), &unstructured.Unstructured{})
+
+	if ret == nil {
+		return nil, err
+	}
+	return castObjectToUnstructured(ret)
+}
+
 func (c *FakeResourceClient) List(opts metav1.ListOptions) (runtime.Object, error) {
 	obj, err := c.Fake.
 		Invokes(testing.NewListAction(c.Resource, c.Kind, c.Namespace, opts), &unstructured.UnstructuredList{})
@@ -212,6 +466,9 @@ func (c *FakeResourceClient) List(opts metav1.ListOptions) (runtime.Object, erro
 	for _, item := range items {
 		accessor, _ := meta.Accessor(item)
 		if label.Matches(labels.Set(accessor.GetLabels())) {
+			if item.GetObjectKind().GroupVersionKind().Empty() {
+				item.GetObjectKind().SetGroupVersionKind(c.Kind)
+			}
 			unstructuredObj, err := castObjectToUnstructured(item)
 			if err != nil {
 				return nil, err
@@ -219,5 +476,71 @@ func (c *FakeResourceClient) List(opts metav1.ListOptions) (runtime.Object, erro
 			list.Items = append(list.Items, *unstructuredObj)
 		}
 	}
-	return list, err
+	return paginate(list, opts)
+}
+
+// paginate emulates chunking of apiserver, the continue token is the offset of the next page
+func paginate(list *unstructured.UnstructuredList, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	if opts.Limit <= 0 {
+		return list, nil
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		if list.Items[i].GetNamespace() != list.Items[j].GetNamespace() {
+			return list.Items[i].GetNamespace() < list.Items[j].GetNamespace()
+		}
+		return list.Items[i].GetName() < list.Items[j].GetName()
+	})
+	offset := 0
+	if opts.Continue != "" {
+		var err error
+		if offset, err = strconv.Atoi(opts.Continue); err != nil || offset < 0 || offset > len(list.Items) {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid continue token %q", opts.Continue))
+		}
+	}
+	end := offset + int(opts.Limit)
+	if end < len(list.Items) {
+		list.SetContinue(strconv.Itoa(end))
+	} else {
+		end = len(list.Items)
+	}
+	list.Items = list.Items[offset:end]
+	return list, nil
+}
+
+// Patch patches the resource or its subresource with get and update actions,
+// since the object tracker of the fake clientset doesn't react to patch actions.
+func (c *FakeResourceClient) Patch(name string, pt types.PatchType, data []byte) (*unstructured.Unstructured, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(c.Resource, c.Namespace, name), &unstructured.Unstructured{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	original, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := applyPatch(original, pt, data, obj)
+	if err != nil {
+		return nil, err
+	}
+	newObj := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+	if err := json.Unmarshal(patched, newObj); err != nil {
+		return nil, err
+	}
+	newObj.GetObjectKind().SetGroupVersionKind(c.Kind)
+
+	updateAction := testing.NewUpdateAction(c.Resource, c.Namespace, newObj)
+	if c.subresource != "" {
+		updateAction = testing.NewUpdateSubresourceAction(c.Resource, c.subresource, c.Namespace, newObj)
+	}
+	obj, err = c.Fake.
+		Invokes(updateAction, &unstructured.Unstructured{})
+
+	if obj == nil {
+		return nil, err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(c.Kind)
+	return castObjectToUnstructured(obj)
 }
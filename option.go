@@ -0,0 +1,178 @@
+package lambda
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	defaultResync   = time.Minute
+	defaultPageSize = 500
+)
+
+// Option configures the client lambda created by the constructors
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	resync           time.Duration
+	qps              float32
+	burst            int
+	userAgent        string
+	cacheSyncTimeout time.Duration
+	tweakListOptions func(*metav1.ListOptions)
+	pageSize         int64
+	namespaces       []string
+	labelSelector    string
+	fieldSelector    string
+}
+
+func newClientOptions(opts []Option) *clientOptions {
+	options := &clientOptions{
+		resync:   defaultResync,
+		pageSize: defaultPageSize,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// WithResync sets the resync period of the informers, zero for no resync
+func WithResync(resync time.Duration) Option {
+	return func(options *clientOptions) {
+		options.resync = resync
+	}
+}
+
+// WithQPS sets the client-side throttling towards the apiserver. It takes no
+// effect on Mock.
+func WithQPS(qps float32, burst int) Option {
+	return func(options *clientOptions) {
+		options.qps = qps
+		options.burst = burst
+	}
+}
+
+// WithUserAgent sets the user agent of the requests to the apiserver. It takes
+// no effect on Mock.
+func WithUserAgent(userAgent string) Option {
+	return func(options *clientOptions) {
+		options.userAgent = userAgent
+	}
+}
+
+// WithCacheSyncTimeout sets the maximum time to wait for the local cache of a resource
+// synced when it's read for the first time, no timeout if zero. The timeout is reported
+// as an error of the lambda reading it.
+func WithCacheSyncTimeout(timeout time.Duration) Option {
+	return func(options *clientOptions) {
+		options.cacheSyncTimeout = timeout
+	}
+}
+
+// WithInformerTweak modifies the list options of every informer, e.g. to cache only
+// the objects matching a label selector
+func WithInformerTweak(tweak func(*metav1.ListOptions)) Option {
+	return func(options *clientOptions) {
+		options.tweakListOptions = tweak
+	}
+}
+
+// WithNamespace restricts the informers to the namespaces, so that the client only needs
+// the permission to list and watch in them. A factory of informers is created for each
+// namespace, and lambdas in no specific namespace read from all of them.
+func WithNamespace(namespaces ...string) Option {
+	return func(options *clientOptions) {
+		options.namespaces = append(options.namespaces, namespaces...)
+	}
+}
+
+// WithLabelSelector caches only the objects matching the label selector, e.g. "app=foo"
+func WithLabelSelector(selector string) Option {
+	return func(options *clientOptions) {
+		options.labelSelector = selector
+	}
+}
+
+// WithFieldSelector caches only the objects matching the field selector, e.g. "status.phase=Running".
+// The field must be supported by every resource read from the local cache.
+func WithFieldSelector(selector string) Option {
+	return func(options *clientOptions) {
+		options.fieldSelector = selector
+	}
+}
+
+// WithPageSize sets the maximum number of objects listed from apiserver per request in
+// live reads, see Lambda.Live. Everything is listed at once if zero.
+func WithPageSize(limit int64) Option {
+	return func(options *clientOptions) {
+		options.pageSize = limit
+	}
+}
+
+// applyToConfig returns a copy of the config with the options applied
+func (options *clientOptions) applyToConfig(config *rest.Config) *rest.Config {
+	config = rest.CopyConfig(config)
+	if options.qps > 0 {
+		config.QPS = options.qps
+		config.Burst = options.burst
+	}
+	if options.userAgent != "" {
+		config.UserAgent = options.userAgent
+	}
+	return config
+}
+
+// validate checks the selectors given
+func (options *clientOptions) validate() error {
+	if _, err := labels.Parse(options.labelSelector); err != nil {
+		return err
+	}
+	if _, err := fields.ParseSelector(options.fieldSelector); err != nil {
+		return err
+	}
+	return nil
+}
+
+// tweak returns the function applying the selectors and the informer tweak to list options
+func (options *clientOptions) tweak() func(*metav1.ListOptions) {
+	if options.labelSelector == "" && options.fieldSelector == "" {
+		return options.tweakListOptions
+	}
+	return func(opts *metav1.ListOptions) {
+		if options.labelSelector != "" {
+			opts.LabelSelector = options.labelSelector
+		}
+		if options.fieldSelector != "" {
+			opts.FieldSelector = options.fieldSelector
+		}
+		if options.tweakListOptions != nil {
+			options.tweakListOptions(opts)
+		}
+	}
+}
+
+// newInformerFactories creates the informer factories keyed by the namespace watched
+func (options *clientOptions) newInformerFactories(client kubernetes.Interface) map[string]informers.SharedInformerFactory {
+	namespaces := options.namespaces
+	for _, namespace := range namespaces {
+		if namespace == metav1.NamespaceAll {
+			namespaces = nil
+			break
+		}
+	}
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	factories := make(map[string]informers.SharedInformerFactory)
+	for _, namespace := range namespaces {
+		factories[namespace] = informers.NewFilteredSharedInformerFactory(client, options.resync, namespace, options.tweak())
+	}
+	return factories
+}
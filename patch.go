@@ -0,0 +1,54 @@
+package lambda
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// createPatch computes the patch from the original object to the modified one.
+// Strategic merge patch is used for typed objects, and JSON merge patch for
+// unstructured ones which have no patch strategy to look up.
+func createPatch(original, modified runtime.Object) (types.PatchType, []byte, error) {
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return "", nil, err
+	}
+	modifiedJSON, err := json.Marshal(modified)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, ok := original.(*unstructured.Unstructured); ok {
+		data, err := jsonpatch.CreateMergePatch(originalJSON, modifiedJSON)
+		return types.MergePatchType, data, err
+	}
+	data, err := strategicpatch.CreateTwoWayMergePatch(originalJSON, modifiedJSON, original)
+	return types.StrategicMergePatchType, data, err
+}
+
+// applyPatch applies the patch to the JSON document. The data struct is
+// the typed object used to look up patch strategy for strategic merge patch.
+func applyPatch(original []byte, patchType types.PatchType, data []byte, dataStruct interface{}) ([]byte, error) {
+	switch patchType {
+	case types.JSONPatchType:
+		patch, err := jsonpatch.DecodePatch(data)
+		if err != nil {
+			return nil, err
+		}
+		return patch.Apply(original)
+	case types.MergePatchType:
+		return jsonpatch.MergePatch(original, data)
+	case types.StrategicMergePatchType:
+		return strategicpatch.StrategicMergePatch(original, data, dataStruct)
+	}
+	return nil, fmt.Errorf("unsupported patch type %s", patchType)
+}
+
+func isEmptyPatch(data []byte) bool {
+	return string(data) == "{}"
+}
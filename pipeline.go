@@ -0,0 +1,384 @@
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Executable is the type-safe counterpart of the executable returned by
+// KubernetesClientLambda.Type, whose pipelines are checked at compile time.
+type Executable[T runtime.Object] struct {
+	exec *kubernetesExecutable
+}
+
+// Of returns a typed executable for the resource. T must be the object type
+// of the resource, e.g. Of[*corev1.Pod](kcl, Pod).
+func Of[T runtime.Object](kcl KubernetesClientLambda, rs Resource) *Executable[T] {
+	return &Executable[T]{
+		exec: kcl.Type(rs),
+	}
+}
+
+// OfE returns a typed executable for the resource, or the error if the resource
+// is not supported, see KubernetesClientLambda.TypeE
+func OfE[T runtime.Object](kcl KubernetesClientLambda, rs Resource) (*Executable[T], error) {
+	exec, err := kcl.TypeE(rs)
+	if err != nil {
+		return nil, err
+	}
+	return &Executable[T]{
+		exec: exec,
+	}, nil
+}
+
+// InNamespace creates a typed pipeline for the resource in the namespaces
+func (exec *Executable[T]) InNamespace(namespaces ...string) *Pipeline[T] {
+	return Typed[T](exec.exec.InNamespace(namespaces...))
+}
+
+// InNamespaceContext creates a typed pipeline bound to the context
+func (exec *Executable[T]) InNamespaceContext(ctx context.Context, namespaces ...string) *Pipeline[T] {
+	return Typed[T](exec.exec.InNamespaceContext(ctx, namespaces...))
+}
+
+// InNamespaceLive creates a typed pipeline reading from apiserver, see Lambda.Live
+func (exec *Executable[T]) InNamespaceLive(namespaces ...string) *Pipeline[T] {
+	return Typed[T](exec.exec.InNamespaceLive(namespaces...))
+}
+
+// Pipeline is a type-safe lambda whose elements are all of type T. Every
+// stage is delegated to the underlying untyped Lambda without reflection,
+// which is confined to the untyped API taking Predicate, Consumer and alike.
+type Pipeline[T runtime.Object] struct {
+	lambda *Lambda
+}
+
+// Typed adapts an untyped lambda to a typed pipeline. Elements not of type T
+// are dropped and recorded as errors of the lambda.
+func Typed[T runtime.Object](lambda *Lambda) *Pipeline[T] {
+	return &Pipeline[T]{
+		lambda: lambda,
+	}
+}
+
+// Lambda returns the untyped lambda under the pipeline, which is used for
+// kubernetes operations such as Create, Update and Delete.
+func (p *Pipeline[T]) Lambda() *Lambda {
+	return p.lambda
+}
+
+func (p *Pipeline[T]) next(lambda *Lambda) *Pipeline[T] {
+	return Typed[T](lambda)
+}
+
+func (p *Pipeline[T]) cast(lambda *Lambda, item runtime.Object) (T, bool) {
+	obj, ok := item.(T)
+	if !ok && item != nil {
+		lambda.addError(fmt.Errorf("unexpected object type %T in pipeline of %T", item, obj))
+	}
+	return obj, ok
+}
+
+// checkNil converts the result of the stage, a nil result including a typed nil is reported as
+// an error of the element instead of being sent downstream. The item is nil for producers.
+func (p *Pipeline[T]) checkNil(verb string, item runtime.Object, result T) runtime.Object {
+	obj := runtime.Object(result)
+	if isNilObject(obj) {
+		p.lambda.addObjectError(verb, item, errors.New("nil return value detected"))
+		return nil
+	}
+	return obj
+}
+
+// WithContext binds the context to the pipeline, see Lambda.WithContext
+func (p *Pipeline[T]) WithContext(ctx context.Context) *Pipeline[T] {
+	return p.next(p.lambda.WithContext(ctx))
+}
+
+// Live makes the following stages read from apiserver, see Lambda.Live
+func (p *Pipeline[T]) Live() *Pipeline[T] {
+	return p.next(p.lambda.Live())
+}
+
+// List lists all items indexed in the local cache
+func (p *Pipeline[T]) List() *Pipeline[T] {
+	return p.next(p.lambda.List())
+}
+
+// ListWithLabelSelector lists items matching the label selector
+func (p *Pipeline[T]) ListWithLabelSelector(selector labels.Selector) *Pipeline[T] {
+	return p.next(p.lambda.ListWithLabelSelector(selector))
+}
+
+// ListWithSelector lists items matching the label selector string
+func (p *Pipeline[T]) ListWithSelector(selector string) *Pipeline[T] {
+	return p.next(p.lambda.ListWithSelector(selector))
+}
+
+// Collect deep copies every element in the pipeline
+func (p *Pipeline[T]) Collect() *Pipeline[T] {
+	return p.next(p.lambda.Collect())
+}
+
+// LatestCreated filters out the latest created object
+func (p *Pipeline[T]) LatestCreated() *Pipeline[T] {
+	return p.next(p.lambda.LatestCreated())
+}
+
+// OldestCreated filters out the oldest created object
+func (p *Pipeline[T]) OldestCreated() *Pipeline[T] {
+	return p.next(p.lambda.OldestCreated())
+}
+
+// SortBy sorts the elements with the comparator, see Lambda.SortBy
+func (p *Pipeline[T]) SortBy(less func(a, b T) bool) *Pipeline[T] {
+	return p.next(p.lambda.sortBy(func(a, b runtime.Object) bool {
+		objA, okA := p.cast(p.lambda, a)
+		objB, okB := p.cast(p.lambda, b)
+		return okA && okB && less(objA, objB)
+	}))
+}
+
+// SortByName sorts the elements by namespace and name
+func (p *Pipeline[T]) SortByName() *Pipeline[T] {
+	return p.next(p.lambda.SortByName())
+}
+
+// SortByCreationTimestamp sorts the elements from the oldest created to the latest
+func (p *Pipeline[T]) SortByCreationTimestamp() *Pipeline[T] {
+	return p.next(p.lambda.SortByCreationTimestamp())
+}
+
+// TopN takes the first n elements ordered by the comparator
+func (p *Pipeline[T]) TopN(n int, less func(a, b T) bool) *Pipeline[T] {
+	return p.SortBy(less).Limit(n)
+}
+
+// Reverse reverses the order of the elements
+func (p *Pipeline[T]) Reverse() *Pipeline[T] {
+	return p.next(p.lambda.Reverse())
+}
+
+// Limit takes at most n elements and drops the rest
+func (p *Pipeline[T]) Limit(n int) *Pipeline[T] {
+	return p.next(p.lambda.Limit(n))
+}
+
+// Skip drops the first n elements and passes the rest
+func (p *Pipeline[T]) Skip(n int) *Pipeline[T] {
+	return p.next(p.lambda.Skip(n))
+}
+
+// Distinct removes duplicated elements, see Lambda.Distinct
+func (p *Pipeline[T]) Distinct() *Pipeline[T] {
+	return p.next(p.lambda.Distinct())
+}
+
+// Union appends elements from the other pipeline and removes duplicated ones
+func (p *Pipeline[T]) Union(other *Pipeline[T]) *Pipeline[T] {
+	return p.next(p.lambda.Union(other.lambda))
+}
+
+// Intersect keeps the elements also present in the other pipeline, see Lambda.Intersect
+func (p *Pipeline[T]) Intersect(other *Pipeline[T]) *Pipeline[T] {
+	return p.next(p.lambda.Intersect(other.lambda))
+}
+
+// Except removes the elements present in the other pipeline, see Lambda.Except
+func (p *Pipeline[T]) Except(other *Pipeline[T]) *Pipeline[T] {
+	return p.next(p.lambda.Except(other.lambda))
+}
+
+// OwnedBy filters out the elements not owned by any element of the owner lambda
+func (p *Pipeline[T]) OwnedBy(owner *Lambda) *Pipeline[T] {
+	return p.next(p.lambda.OwnedBy(owner))
+}
+
+// First returns the first element matches the predicate
+func (p *Pipeline[T]) First(predicate func(T) bool) *Pipeline[T] {
+	return p.next(p.lambda.first(func(item runtime.Object) bool {
+		obj, ok := p.cast(p.lambda, item)
+		return ok && predicate(obj)
+	}))
+}
+
+// Grep returns the elements matches the predicate
+func (p *Pipeline[T]) Grep(predicate func(T) bool) *Pipeline[T] {
+	return p.next(p.lambda.grep(func(item runtime.Object) bool {
+		obj, ok := p.cast(p.lambda, item)
+		return ok && predicate(obj)
+	}))
+}
+
+// Map transforms and replace the elements and put them to the next stage
+func (p *Pipeline[T]) Map(consumer func(T) T) *Pipeline[T] {
+	return p.next(p.lambda.mapping(func(item runtime.Object) runtime.Object {
+		obj, ok := p.cast(p.lambda, item)
+		if !ok {
+			return nil
+		}
+		return p.checkNil(VerbMap, item, consumer(obj))
+	}))
+}
+
+// Iter iterates the elements and apply function to them
+func (p *Pipeline[T]) Iter(function func(T)) *Pipeline[T] {
+	return p.next(p.lambda.iter(func(item runtime.Object) {
+		if obj, ok := p.cast(p.lambda, item); ok {
+			function(obj)
+		}
+	}))
+}
+
+// MapParallel is the concurrent version of Map, see Lambda.MapParallel
+func (p *Pipeline[T]) MapParallel(workers int, consumer func(T) T, opts ...ParallelOption) *Pipeline[T] {
+	return p.next(p.lambda.parallel(workers, opts, func(item runtime.Object) (runtime.Object, bool) {
+		obj, ok := p.cast(p.lambda, item)
+		if !ok {
+			return nil, false
+		}
+		result := p.checkNil(VerbMap, item, consumer(obj))
+		return result, result != nil
+	}))
+}
+
+// GrepParallel is the concurrent version of Grep, see Lambda.GrepParallel
+func (p *Pipeline[T]) GrepParallel(workers int, predicate func(T) bool, opts ...ParallelOption) *Pipeline[T] {
+	return p.next(p.lambda.parallel(workers, opts, func(item runtime.Object) (runtime.Object, bool) {
+		obj, ok := p.cast(p.lambda, item)
+		return item, ok && predicate(obj)
+	}))
+}
+
+// IterParallel is the concurrent version of Iter, see Lambda.IterParallel
+func (p *Pipeline[T]) IterParallel(workers int, function func(T), opts ...ParallelOption) *Pipeline[T] {
+	return p.next(p.lambda.parallel(workers, opts, func(item runtime.Object) (runtime.Object, bool) {
+		obj, ok := p.cast(p.lambda, item)
+		if ok {
+			function(obj)
+		}
+		return item, ok
+	}))
+}
+
+// Add calls the producer and put the returned value into elements
+func (p *Pipeline[T]) Add(producer func() T) *Pipeline[T] {
+	return p.next(p.lambda.add(func() runtime.Object {
+		return p.checkNil(VerbAdd, nil, producer())
+	}))
+}
+
+// Each applies function to every element
+func (p *Pipeline[T]) Each(function func(T)) error {
+	return p.lambda.each(func(item runtime.Object) {
+		if obj, ok := p.cast(p.lambda, item); ok {
+			function(obj)
+		}
+	})
+}
+
+// Any checks if any element get a true from predicate
+func (p *Pipeline[T]) Any(predicate func(T) bool) (bool, error) {
+	return p.lambda.any(func(item runtime.Object) bool {
+		obj, ok := p.cast(p.lambda, item)
+		return ok && predicate(obj)
+	})
+}
+
+// Every checks if every element get a true from predicate
+func (p *Pipeline[T]) Every(predicate func(T) bool) (bool, error) {
+	return p.lambda.every(func(item runtime.Object) bool {
+		obj, ok := p.cast(p.lambda, item)
+		return ok && predicate(obj)
+	})
+}
+
+// NotEmpty checks if any element remains
+func (p *Pipeline[T]) NotEmpty() (bool, error) {
+	return p.lambda.NotEmpty()
+}
+
+// Count returns the number of elements
+func (p *Pipeline[T]) Count() (int, error) {
+	return p.lambda.Count()
+}
+
+// GroupBy classifies elements by the key returned from key function
+func (p *Pipeline[T]) GroupBy(keyFunction func(T) string) (map[string][]T, error) {
+	groups := make(map[string][]T)
+	err := p.Each(func(obj T) {
+		key := keyFunction(obj)
+		groups[key] = append(groups[key], obj)
+	})
+	return groups, err
+}
+
+// Partition splits the elements into two pipelines by the predicate, see Lambda.Partition
+func (p *Pipeline[T]) Partition(predicate func(T) bool) (matched, unmatched *Pipeline[T]) {
+	matchedLambda, unmatchedLambda := p.lambda.partition(func(item runtime.Object) bool {
+		obj, ok := p.cast(p.lambda, item)
+		return ok && predicate(obj)
+	})
+	return p.next(matchedLambda), p.next(unmatchedLambda)
+}
+
+// Reduce folds elements of the pipeline into one value by applying the accumulator to every element
+func Reduce[T runtime.Object, A any](p *Pipeline[T], initial A, accumulator func(A, T) A) (A, error) {
+	result := initial
+	err := p.Each(func(obj T) {
+		result = accumulator(result, obj)
+	})
+	return result, err
+}
+
+// WaitUntil blocks until every element satisfies the predicate, see Lambda.WaitUntil
+func (p *Pipeline[T]) WaitUntil(predicate func(T) bool, timeout time.Duration) error {
+	return p.lambda.waitUntil(func(item runtime.Object) bool {
+		obj, ok := p.cast(p.lambda, item)
+		return ok && predicate(obj)
+	}, true, timeout)
+}
+
+// WaitUntilAny blocks until any element satisfies the predicate, see Lambda.WaitUntil
+func (p *Pipeline[T]) WaitUntilAny(predicate func(T) bool, timeout time.Duration) error {
+	return p.lambda.waitUntil(func(item runtime.Object) bool {
+		obj, ok := p.cast(p.lambda, item)
+		return ok && predicate(obj)
+	}, false, timeout)
+}
+
+// Element returns a single element
+func (p *Pipeline[T]) Element() (T, error) {
+	var zero T
+	item, err := p.lambda.Element()
+	if err != nil {
+		return zero, err
+	}
+	obj, ok := item.(T)
+	if !ok {
+		return zero, fmt.Errorf("unexpected object type %T in pipeline of %T", item, zero)
+	}
+	return obj, nil
+}
+
+// Elements returns all elements from the pipeline
+func (p *Pipeline[T]) Elements() ([]T, error) {
+	items, err := p.lambda.Elements()
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]T, 0, len(items))
+	for _, item := range items {
+		obj, ok := item.(T)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object type %T in pipeline of %T", item, obj)
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
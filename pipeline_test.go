@@ -0,0 +1,122 @@
+package lambda
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestTypedPipeline(t *testing.T) {
+	mock := Mock()
+	created, err := Of[*corev1.ConfigMap](mock, ConfigMap).
+		InNamespace("foons").
+		Add(func() *corev1.ConfigMap {
+			cm := &corev1.ConfigMap{}
+			cm.Name = "testcm1"
+			cm.Namespace = "foons"
+			return cm
+		}).
+		Add(func() *corev1.ConfigMap {
+			cm := &corev1.ConfigMap{}
+			cm.Name = "testcm2"
+			cm.Namespace = "foons"
+			return cm
+		}).
+		Lambda().Create()
+	assert.True(t, created, "not created")
+	assert.NoError(t, err, "creation failed")
+
+	cms, err := Of[*corev1.ConfigMap](mock, ConfigMap).
+		InNamespace("foons").
+		List().
+		Grep(func(cm *corev1.ConfigMap) bool {
+			return cm.Name == "testcm2"
+		}).
+		Map(func(cm *corev1.ConfigMap) *corev1.ConfigMap {
+			cm.Labels = map[string]string{"foo": "bar"}
+			return cm
+		}).
+		Elements()
+	assert.NoError(t, err, "some error")
+	assert.Equal(t, 1, len(cms), "configmap count wrong")
+	assert.Equal(t, "bar", cms[0].Labels["foo"], "configmap not mapped")
+}
+
+func TestTypedPipelineWrongType(t *testing.T) {
+	count := 0
+	err := Typed[*corev1.Pod](Mock().Type(ConfigMap).InNamespace("foons").
+		Add(func() *corev1.ConfigMap {
+			cm := &corev1.ConfigMap{}
+			cm.Name = "testcm1"
+			return cm
+		})).
+		Each(func(pod *corev1.Pod) {
+			count++
+		})
+	assert.Equal(t, 0, count, "mismatched type consumed")
+	assert.Error(t, err, "mismatched type not reported")
+}
+
+func TestTypedPipelineMapNil(t *testing.T) {
+	cm1 := &corev1.ConfigMap{}
+	cm1.Name = "testcm1"
+	cm1.Namespace = "foons"
+	cm2 := cm1.DeepCopy()
+	cm2.Name = "testcm2"
+	mapper := func(cm *corev1.ConfigMap) *corev1.ConfigMap {
+		if cm.Name == "testcm1" {
+			return nil
+		}
+		return cm
+	}
+	pipelines := map[string]func(*Pipeline[*corev1.ConfigMap]) *Pipeline[*corev1.ConfigMap]{
+		"Map": func(p *Pipeline[*corev1.ConfigMap]) *Pipeline[*corev1.ConfigMap] {
+			return p.Map(mapper)
+		},
+		"MapParallel": func(p *Pipeline[*corev1.ConfigMap]) *Pipeline[*corev1.ConfigMap] {
+			return p.MapParallel(2, mapper)
+		},
+	}
+	for name, pipeline := range pipelines {
+		mapped := pipeline(Of[*corev1.ConfigMap](Mock(cm1, cm2), ConfigMap).InNamespace("foons").List())
+		cms, err := mapped.Elements()
+		assert.NoError(t, err, "%s: some error", name)
+		assert.Equal(t, 1, len(cms), "%s: nil result sent downstream", name)
+		for _, cm := range cms {
+			assert.NotNil(t, cm, "%s: nil result sent downstream", name)
+		}
+		errs := mapped.Lambda().Errors()
+		var objErr *ObjectError
+		if assert.Equal(t, 1, len(errs), "%s: nil result not reported", name) &&
+			assert.True(t, errors.As(errs[0], &objErr), "%s: not an object error: %v", name, errs[0]) {
+			assert.Equal(t, VerbMap, objErr.Verb, "%s: wrong verb", name)
+			assert.Equal(t, "testcm1", objErr.Name, "%s: wrong object", name)
+		}
+	}
+}
+
+func TestTypedPipelineAddNil(t *testing.T) {
+	added := Of[*corev1.ConfigMap](Mock(), ConfigMap).InNamespace("foons").
+		Add(func() *corev1.ConfigMap {
+			return nil
+		}).
+		Add(func() *corev1.ConfigMap {
+			cm := &corev1.ConfigMap{}
+			cm.Name = "testcm1"
+			cm.Namespace = "foons"
+			return cm
+		})
+	cms, err := added.Elements()
+	assert.NoError(t, err, "some error")
+	if assert.Equal(t, 1, len(cms), "nil result sent downstream") {
+		assert.Equal(t, "testcm1", cms[0].Name, "configmap wrong")
+	}
+	errs := added.Lambda().Errors()
+	var objErr *ObjectError
+	if assert.Equal(t, 1, len(errs), "nil result not reported") &&
+		assert.True(t, errors.As(errs[0], &objErr), "not an object error: %v", errs[0]) {
+		assert.Equal(t, VerbAdd, objErr.Verb, "wrong verb")
+	}
+}
@@ -3,12 +3,23 @@ package lambda
 import (
 	"reflect"
 	"regexp"
+
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 func isZeroOfUnderlyingType(x interface{}) bool {
 	return reflect.DeepEqual(x, reflect.Zero(reflect.TypeOf(x)).Interface())
 }
 
+// isNilObject tells if the object is nil, including a typed nil hidden in the interface
+func isNilObject(obj runtime.Object) bool {
+	if obj == nil {
+		return true
+	}
+	v := reflect.ValueOf(obj)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
 func regexMatch(str, regex string) (bool, error) {
 	r, err := regexp.Compile(regex)
 	if err != nil {